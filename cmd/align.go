@@ -5,20 +5,24 @@ import (
 	"github.com/spf13/cobra"
 	"fmt"
 	"os"
+	"iter"
+	"strings"
 )
 
 var alignFile, outFormat string
 
 var flip bool
 
+var buildMismatch string
+
 var alignCmd = &cobra.Command{
 	Use:   "align",
 	Short: "Aligns DNA sequences with a reference.",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Fprintln(os.Stderr, "[INFO] Aligning...")
 		if err := align(inFile, inFormat, outFile, outFormat, alignFile); err != nil {
-			fmt.Fprintln(os.Stderr, "[WARNING] Error during alignment: %v\n", err)
-			return
+			fmt.Fprintf(os.Stderr, "[WARNING] Error during alignment: %v\n", err)
+			os.Exit(1)
 		}
 		fmt.Fprintln(os.Stderr, "[INFO] Alignment completed successfully.")
 	},
@@ -27,7 +31,10 @@ var alignCmd = &cobra.Command{
 		if inFile == "" || inFormat == "" || outFile == "" || alignFile == "" {
 			cmd.Help()
 		}
-		return nil
+		if buildMismatch != "warn" && buildMismatch != "refuse" {
+			return fmt.Errorf("unsupported build mismatch rule: %s (options: warn, refuse)", buildMismatch)
+		}
+		return validateFormats(inFormat, outFormat)
 	},
 }
 
@@ -35,13 +42,25 @@ func init() {
 	rootCmd.AddCommand(alignCmd)
 
 	alignCmd.Flags().StringVarP(&inFile, "inFile", "i", "", "")
-	alignCmd.Flags().StringVarP(&inFormat, "inFormat", "f", "", "")
+	alignCmd.Flags().StringVarP(&inFormat, "inFormat", "f", "auto", "")
 	alignCmd.Flags().StringVarP(&outFile, "outFile", "o", "", "")
 	alignCmd.Flags().StringVarP(&outFormat, "outFormat", "t", "23andme", "")
 	alignCmd.Flags().StringVarP(&alignFile, "alignFile", "a", "", "")
 	alignCmd.Flags().BoolVar(&flip, "flip", false, "")
+	alignCmd.Flags().StringVar(&buildMismatch, "buildMismatch", "warn", "")
+	alignCmd.Flags().StringVar(&sample, "sample", "", "")
+	alignCmd.Flags().StringVar(&indels, "indels", "skip", "")
+	alignCmd.Flags().StringVar(&multiAllelic, "multiAllelic", "skip", "")
+	alignCmd.Flags().IntVar(&minGQ, "minGQ", 0, "")
+	alignCmd.Flags().IntVar(&minDP, "minDP", 0, "")
+	alignCmd.Flags().StringVar(&pseudoHaploid, "pseudoHaploid", "error", "")
+	alignCmd.Flags().BoolVar(&strict, "strict", false, "")
+	alignCmd.Flags().StringVar(&rsidMap, "rsidMap", "", "")
+	alignCmd.Flags().StringVar(&sampleID, "sampleID", "", "")
+	alignCmd.Flags().StringVar(&familyID, "familyID", "", "")
+	alignCmd.Flags().StringVar(&sex, "sex", "unknown", "")
+	alignCmd.Flags().StringVar(&population, "population", "", "")
 	alignCmd.MarkFlagRequired("inFile")
-	alignCmd.MarkFlagRequired("inFormat")
 	alignCmd.MarkFlagRequired("outFile")
 	alignCmd.MarkFlagRequired("alignFile")
 
@@ -51,52 +70,95 @@ func init() {
 
 func align(inFile, inFormat, outFile, outFormat, alignFile string) error {
 
-	var result internal.ParseResult
-	switch inFormat {
-		case "ancestry":
-			result = internal.ParseAncestryDNA(inFile)
-		case "23andme":
-			result = internal.Parse23andMe(inFile)
-		case "ftdnav2":
-			result = internal.ParseFTDNA(inFile)
-		case "ftdnav1", "myheritage":
-			result = internal.ParseMyHeritage(inFile)
-		default:
-			return fmt.Errorf("unsupported input format: %s", inFormat)
+	inFormat, err := resolveInFormat(inFile, inFormat)
+	if err != nil {
+		return err
+	}
+	opts, err := writeOptions()
+	if err != nil {
+		return err
 	}
 
+	result := internal.Parse(inFile, inFormat, parseOptions())
+
 	if result.Err != nil {
 		return result.Err
 	}
+	if result.Data, err = renameRecords(result.Data); err != nil {
+		return err
+	}
+	result.Data = internal.ApplyPloidy(result.Data, opts.Sex)
+	if err := sourceOptions(&opts, result.Data, inFormat); err != nil {
+		return err
+	}
 
-	templateRecords, err := internal.ParseTemplate(alignFile)
+	templateRecords, err := internal.ParseTemplate(alignFile, parseOptions())
 	if err != nil {
 		return fmt.Errorf("error parsing template file: %v", err)
 	}
+	// The output takes the positions, and so the build, of the template
+	if opts.Build, err = checkBuild(opts.Build, templateRecords); err != nil {
+		return err
+	}
 
-	return internal.AlignDNA(result.Data, templateRecords, outFile, outFormat, flip)
+	if err := internal.AlignDNA(result.Data, templateRecords, outFile, outFormat, flip, opts); err != nil {
+		return err
+	}
+	printParseReport()
+	return nil
+}
+
+// checkBuild compares the genome build of the kit with the one of the
+// template, when both can be told, and warns or refuses on a mismatch. It
+// returns the build of the output.
+func checkBuild(kitBuild string, templateRecords iter.Seq2[internal.TemplateRecord, error]) (string, error) {
+	templateBuild, err := internal.DetectTemplateBuild(templateRecords)
+	if err != nil {
+		return "", fmt.Errorf("error parsing template file: %v", err)
+	}
+	if templateBuild == "" {
+		return kitBuild, nil
+	}
+	if kitBuild == "" || kitBuild == templateBuild {
+		return templateBuild, nil
+	}
+
+	message := fmt.Sprintf("kit positions are on build %s but the template is on build %s", kitBuild, templateBuild)
+	if buildMismatch == "refuse" {
+		return "", fmt.Errorf("%s, lift the kit over first", message)
+	}
+	fmt.Fprintf(os.Stderr, "[WARNING] The %s, sites without an rsID will not match.\n", message)
+	return templateBuild, nil
 }
 
 func AlignHelp(cmd *cobra.Command, args []string) {
 	fmt.Fprintln(cmd.OutOrStdout(), "Aligns DNA sequences with a reference.")
 	fmt.Fprintln(cmd.OutOrStdout(), "https://github.com/enelsr/terraseq")
 	fmt.Fprintln(cmd.OutOrStdout(), "")
-	fmt.Fprintln(cmd.OutOrStdout(), "usage: terraseq align [-a|--alignFile FILE] [-i|--inFile FILE] [-f|--inFormat FORMAT]")
-	fmt.Fprintln(cmd.OutOrStdout(), "                      [-o|--outFile FILE] (-t|--outFormat FORMAT) (--flip)")
+	fmt.Fprintln(cmd.OutOrStdout(), "usage: terraseq align [-a|--alignFile FILE] [-i|--inFile FILE] (-f|--inFormat FORMAT)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      [-o|--outFile FILE] (-t|--outFormat FORMAT) (--flip) (--buildMismatch RULE)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--sample NAME) (--indels RULE) (--multiAllelic RULE)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--minGQ N) (--minDP N) (--pseudoHaploid RULE) (--strict)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--rsidMap FILE)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--sampleID ID) (--familyID ID) (--sex SEX) (--population LABEL)")
 	fmt.Fprintln(cmd.OutOrStdout(), "")
 	fmt.Fprintln(cmd.OutOrStdout(), "Parse optional command line arguments.")
 	fmt.Fprintln(cmd.OutOrStdout(), "")
 	fmt.Fprintln(cmd.OutOrStdout(), "options:")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -h, --help                  Display this help message and exit")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -a, --alignFile FILE        Specify the path to the alignment file")
-	fmt.Fprintln(cmd.OutOrStdout(), "                              (e.g., 1240K.bim, 1240K.snp)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (.bim, .snp, .map, .pvar, .legend or sites-only .vcf)")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -i, --inFile FILE           Specify the path to the input file")
 	fmt.Fprintln(cmd.OutOrStdout(), "                              (e.g., input.txt)")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -f, --inFormat FORMAT       Define the format of the input file")
-	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: 23andme, ancestry, ftdnav1, ftdnav2, myheritage)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: auto, " + strings.Join(internal.InputFormats(), ", ") + ")")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -o, --outFile FILE          Specify the path for the output file")
 	fmt.Fprintln(cmd.OutOrStdout(), "                              (e.g., output.txt)")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -t, --outFormat FORMAT      Define the format of the output file")
-	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: 23andme, ancestry, ftdnav1, ftdnav2, myheritage)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: " + strings.Join(internal.OutputFormats(), ", ") + ")")
 	fmt.Fprintln(cmd.OutOrStdout(), "  --flip                      Flips the alleles in accordance with the reference")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --buildMismatch RULE        Handle a kit on another genome build than the template")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: warn, refuse; default: warn)")
+	printInputOptions(cmd)
+	printOutputOptions(cmd)
 }
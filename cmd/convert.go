@@ -4,19 +4,33 @@ import (
 	"terraseq/internal"
 	"github.com/spf13/cobra"
 	"os"
+	"strings"
 	"fmt"
 )
 
 var inFile, inFormat, outFile string
 
+var sample, indels, multiAllelic string
+
+var minGQ, minDP int
+
+var pseudoHaploid, rsidMap string
+
+var strict bool
+
+// Malformed lines skipped by the last lenient parse
+var parseReport internal.ParseReport
+
+var sampleID, familyID, sex, population string
+
 var convertCmd = &cobra.Command{
 	Use:   "convert",
 	Short: "Converts a DNA file to another format.",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(os.Stderr, "[INFO] Converting to %s...\n", outFormat)
 		if err := convert(inFile, inFormat, outFile, outFormat); err != nil {
-			fmt.Fprintln(os.Stderr, "[WARNING] Error during conversion: %v\n", err)
-			return
+			fmt.Fprintf(os.Stderr, "[WARNING] Error during conversion: %v\n", err)
+			os.Exit(1)
 		}
 		fmt.Fprintf(os.Stderr, "[INFO] Conversion completed successfully.\n")
 	},
@@ -25,7 +39,7 @@ var convertCmd = &cobra.Command{
 		if inFile == "" || inFormat == "" || outFile == "" || outFormat == "" {
 			cmd.Help()
 		}
-		return nil
+		return validateFormats(inFormat, outFormat)
 	},
 }
 
@@ -33,11 +47,22 @@ func init() {
 	rootCmd.AddCommand(convertCmd)
 
 	convertCmd.Flags().StringVarP(&inFile, "inFile", "i", "", "Path to input file")
-	convertCmd.Flags().StringVarP(&inFormat, "inFormat", "f", "", "Format of input file")
+	convertCmd.Flags().StringVarP(&inFormat, "inFormat", "f", "auto", "Format of input file")
 	convertCmd.Flags().StringVarP(&outFile, "outFile", "o", "", "Path to output file")
 	convertCmd.Flags().StringVarP(&outFormat, "outFormat", "t", "23andme", "Format of output file")
+	convertCmd.Flags().StringVar(&sample, "sample", "", "")
+	convertCmd.Flags().StringVar(&indels, "indels", "skip", "")
+	convertCmd.Flags().StringVar(&multiAllelic, "multiAllelic", "skip", "")
+	convertCmd.Flags().IntVar(&minGQ, "minGQ", 0, "")
+	convertCmd.Flags().IntVar(&minDP, "minDP", 0, "")
+	convertCmd.Flags().StringVar(&pseudoHaploid, "pseudoHaploid", "error", "")
+	convertCmd.Flags().BoolVar(&strict, "strict", false, "")
+	convertCmd.Flags().StringVar(&rsidMap, "rsidMap", "", "")
+	convertCmd.Flags().StringVar(&sampleID, "sampleID", "", "")
+	convertCmd.Flags().StringVar(&familyID, "familyID", "", "")
+	convertCmd.Flags().StringVar(&sex, "sex", "unknown", "")
+	convertCmd.Flags().StringVar(&population, "population", "", "")
 	convertCmd.MarkFlagRequired("inFile")
-	convertCmd.MarkFlagRequired("inFormat")
 	convertCmd.MarkFlagRequired("outFile")
 	convertCmd.MarkFlagRequired("outFormat")
 
@@ -46,34 +71,45 @@ func init() {
 }
 
 func convert(inFile, inFormat, outFile, outFormat string) error {
-	var result internal.ParseResult
-
-	switch inFormat {
-		case "ancestry":
-			result = internal.ParseAncestryDNA(inFile)
-		case "23andme":
-			result = internal.Parse23andMe(inFile)
-		case "ftdnav2":
-			result = internal.ParseFTDNA(inFile)
-		case "ftdnav1", "myheritage":
-			result = internal.ParseMyHeritage(inFile)
-		default:
-			return fmt.Errorf("unsupported input format: %s", inFormat)
+	inFormat, err := resolveInFormat(inFile, inFormat)
+	if err != nil {
+		return err
 	}
+	opts, err := writeOptions()
+	if err != nil {
+		return err
+	}
+
+	result := internal.Parse(inFile, inFormat, parseOptions())
 
 	if result.Err != nil {
 		return result.Err
 	}
+	if result.Data, err = renameRecords(result.Data); err != nil {
+		return err
+	}
+	result.Data = internal.ApplyPloidy(result.Data, opts.Sex)
+	if err := sourceOptions(&opts, result.Data, inFormat); err != nil {
+		return err
+	}
 
-	return internal.WriteDNAData(result.Data, outFile, outFormat)
+	if err := internal.WriteDNAData(result.Data, outFile, outFormat, opts); err != nil {
+		return err
+	}
+	printParseReport()
+	return nil
 }
 
 func ConvertHelp(cmd *cobra.Command, args []string) {
 	fmt.Fprintln(cmd.OutOrStdout(), "Converts a DNA file to another format.")
 	fmt.Fprintln(cmd.OutOrStdout(), "https://github.com/enelsr/terraseq")
 	fmt.Fprintln(cmd.OutOrStdout(), "")
-	fmt.Fprintln(cmd.OutOrStdout(), "usage: terraseq convert [-i|--inFile FILE] [-f|--inFormat FORMAT]")
+	fmt.Fprintln(cmd.OutOrStdout(), "usage: terraseq convert [-i|--inFile FILE] (-f|--inFormat FORMAT)")
 	fmt.Fprintln(cmd.OutOrStdout(), "                      [-o|--outFile FILE] [-t|--outFormat FORMAT]")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--sample NAME) (--indels RULE) (--multiAllelic RULE)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--minGQ N) (--minDP N) (--pseudoHaploid RULE) (--strict)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--rsidMap FILE)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--sampleID ID) (--familyID ID) (--sex SEX) (--population LABEL)")
 	fmt.Fprintln(cmd.OutOrStdout(), "")
 	fmt.Fprintln(cmd.OutOrStdout(), "Parse optional command line arguments.")
 	fmt.Fprintln(cmd.OutOrStdout(), "")
@@ -82,9 +118,11 @@ func ConvertHelp(cmd *cobra.Command, args []string) {
 	fmt.Fprintln(cmd.OutOrStdout(), "  -i, --inFile FILE           Specify the path to the input file")
 	fmt.Fprintln(cmd.OutOrStdout(), "                              (e.g., input.txt)")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -f, --inFormat FORMAT       Define the input file format")
-	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: 23andme, ancestry, ftdnav1, ftdnav2, myheritage)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: auto, " + strings.Join(internal.InputFormats(), ", ") + ")")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -o, --outFile FILE          Specify the path for the output file")
 	fmt.Fprintln(cmd.OutOrStdout(), "                              (e.g., output.txt)")
 	fmt.Fprintln(cmd.OutOrStdout(), "  -t, --outFormat FORMAT      Define the output file format")
-	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: 23andme, ancestry, ftdnav1, ftdnav2, myheritage)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: " + strings.Join(internal.OutputFormats(), ", ") + ")")
+	printInputOptions(cmd)
+	printOutputOptions(cmd)
 }
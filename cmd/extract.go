@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"terraseq/internal"
+	"github.com/spf13/cobra"
+	"fmt"
+	"os"
+	"strings"
+	"path/filepath"
+)
+
+var extractCmd = &cobra.Command{
+	Use:   "extract",
+	Short: "Extracts one individual of an EIGENSTRAT dataset or a kit database.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(os.Stderr, "[INFO] Extracting %s...\n", sample)
+		if err := extract(inFile, outFile, outFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "[WARNING] Error during extraction: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "[INFO] Extraction completed successfully.")
+	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+
+		if inFile == "" || sample == "" || outFile == "" {
+			cmd.Help()
+		}
+		return validateFormats("eigenstrat", outFormat)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(extractCmd)
+
+	extractCmd.Flags().StringVarP(&inFile, "inFile", "i", "", "")
+	extractCmd.Flags().StringVarP(&outFile, "outFile", "o", "", "")
+	extractCmd.Flags().StringVarP(&outFormat, "outFormat", "t", "23andme", "")
+	extractCmd.Flags().StringVar(&sample, "sample", "", "")
+	extractCmd.Flags().StringVar(&pseudoHaploid, "pseudoHaploid", "error", "")
+	extractCmd.Flags().BoolVar(&strict, "strict", false, "")
+	extractCmd.Flags().StringVar(&sampleID, "sampleID", "", "")
+	extractCmd.Flags().StringVar(&familyID, "familyID", "", "")
+	extractCmd.Flags().StringVar(&sex, "sex", "unknown", "")
+	extractCmd.Flags().StringVar(&population, "population", "", "")
+	extractCmd.MarkFlagRequired("inFile")
+	extractCmd.MarkFlagRequired("sample")
+	extractCmd.MarkFlagRequired("outFile")
+
+	extractCmd.SetHelpFunc(ExtractHelp)
+	extractCmd.SilenceUsage = true
+}
+
+// extract reads the individual from the .geno/.snp/.ind files, or a kit back
+// from a database written by the sqlite output. The text and packed
+// EIGENSTRAT layouts share a parser, which tells them apart by the .geno
+// header.
+func extract(inFile, outFile, outFormat string) error {
+	if sampleID == "" {
+		sampleID = sample
+	}
+	opts, err := writeOptions()
+	if err != nil {
+		return err
+	}
+
+	inFormat := "eigenstrat"
+	switch strings.ToLower(filepath.Ext(inFile)) {
+		case ".db", ".sqlite", ".sqlite3":
+			inFormat = "sqlite"
+	}
+	result := internal.Parse(inFile, inFormat, parseOptions())
+
+	if result.Err != nil {
+		return result.Err
+	}
+	result.Data = internal.ApplyPloidy(result.Data, opts.Sex)
+	if err := sourceOptions(&opts, result.Data, inFormat); err != nil {
+		return err
+	}
+	if inFormat == "eigenstrat" && pseudoHaploid == "homozygous" {
+		fmt.Fprintln(os.Stderr, "[WARNING] Pseudo-haploid calls are written as homozygous genotypes.")
+	}
+
+	if err := internal.WriteDNAData(result.Data, outFile, outFormat, opts); err != nil {
+		return err
+	}
+	printParseReport()
+	return nil
+}
+
+func ExtractHelp(cmd *cobra.Command, args []string) {
+	fmt.Fprintln(cmd.OutOrStdout(), "Extracts one individual of an EIGENSTRAT dataset or a kit database.")
+	fmt.Fprintln(cmd.OutOrStdout(), "https://github.com/enelsr/terraseq")
+	fmt.Fprintln(cmd.OutOrStdout(), "")
+	fmt.Fprintln(cmd.OutOrStdout(), "usage: terraseq extract [-i|--inFile FILE] [--sample NAME]")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      [-o|--outFile FILE] (-t|--outFormat FORMAT) (--pseudoHaploid RULE)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--strict)")
+	fmt.Fprintln(cmd.OutOrStdout(), "                      (--sampleID ID) (--familyID ID) (--sex SEX) (--population LABEL)")
+	fmt.Fprintln(cmd.OutOrStdout(), "")
+	fmt.Fprintln(cmd.OutOrStdout(), "Parse optional command line arguments.")
+	fmt.Fprintln(cmd.OutOrStdout(), "")
+	fmt.Fprintln(cmd.OutOrStdout(), "options:")
+	fmt.Fprintln(cmd.OutOrStdout(), "  -h, --help                  Display this help message and exit")
+	fmt.Fprintln(cmd.OutOrStdout(), "  -i, --inFile FILE           Specify the .geno, .snp or .ind file, or their prefix,")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              or a .db written by the sqlite output")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (e.g., v54.1_1240K_public.geno, kits.db)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --sample NAME               Individual ID in the .ind file, or sample ID in the .db")
+	fmt.Fprintln(cmd.OutOrStdout(), "  -o, --outFile FILE          Specify the path for the output file")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (e.g., output.txt)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  -t, --outFormat FORMAT      Define the format of the output file")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: " + strings.Join(internal.OutputFormats(), ", ") + ")")
+	printPseudoHaploidOption(cmd)
+	printStrictOption(cmd)
+	fmt.Fprintln(cmd.OutOrStdout(), "  --sampleID ID               Name of the sample in the output")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (default: the individual ID)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --familyID ID               Family ID in PLINK output (default: the sample ID)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --sex SEX                   Sex of the sample (options: male, female, unknown)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --population LABEL          Population label in EIGENSTRAT .ind output")
+}
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"terraseq/internal"
 	"github.com/spf13/cobra"
+	"fmt"
 	"os"
+	"strings"
+	"path/filepath"
 )
 
 var rootCmd = &cobra.Command{
@@ -24,4 +28,140 @@ func init() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 }
 
+func validateFormats(inFormat, outFormat string) error {
+	// "auto" is resolved from the file contents once the command runs
+	if inFormat != "auto" {
+		if format, exists := internal.LookupFormat(inFormat); !exists || format.Parse == nil {
+			return fmt.Errorf("unsupported input format: %s (options: auto, %s)", inFormat, strings.Join(internal.InputFormats(), ", "))
+		}
+	}
+	if format, exists := internal.LookupFormat(outFormat); !exists || format.NewWriter == nil {
+		return fmt.Errorf("unsupported output format: %s (options: %s)", outFormat, strings.Join(internal.OutputFormats(), ", "))
+	}
+	return nil
+}
+
+// resolveInFormat sniffs the input file when the format is "auto".
+func resolveInFormat(inFile, inFormat string) (string, error) {
+	if inFormat != "auto" {
+		return inFormat, nil
+	}
+
+	detection, err := internal.DetectFormat(inFile)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "[INFO] Detected input format: %s (confidence %.0f%%)\n", detection.Format, detection.Confidence*100)
+	if detection.Confidence < 0.5 {
+		fmt.Fprintf(os.Stderr, "[WARNING] Low confidence, the file may also be %s. Set --inFormat to override.\n", detection.RunnerUp)
+	}
+	return detection.Format, nil
+}
+
+func parseOptions() internal.ParseOptions {
+	return internal.ParseOptions{
+		Sample:        sample,
+		Indels:        indels,
+		MultiAllelic:  multiAllelic,
+		MinGQ:         minGQ,
+		MinDP:         minDP,
+		Strict:        strict,
+		Report:        &parseReport,
+		PseudoHaploid: pseudoHaploid,
+	}
+}
+
+// printParseReport lists the malformed lines skipped while reading the kit.
+func printParseReport() {
+	if parseReport.Count == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[WARNING] Skipped %d malformed lines (use --strict to stop at the first one):\n", parseReport.Count)
+	for _, problem := range parseReport.Problems {
+		fmt.Fprintf(os.Stderr, "  %v\n", &problem)
+	}
+	if more := parseReport.Count - len(parseReport.Problems); more > 0 {
+		fmt.Fprintf(os.Stderr, "  ... and %d more\n", more)
+	}
+}
+
+// renameRecords translates internal IDs to rsIDs with the --rsidMap table.
+func renameRecords(data internal.DNAData) (internal.DNAData, error) {
+	if rsidMap == "" {
+		return data, nil
+	}
+	rsids, err := internal.LoadRSIDMap(rsidMap)
+	if err != nil {
+		return data, fmt.Errorf("error reading rsID map: %v", err)
+	}
+	return internal.RenameRecords(data, rsids), nil
+}
+
+// sourceOptions records where the kit came from, for the sqlite output.
+func sourceOptions(opts *internal.WriteOptions, data internal.DNAData, inFormat string) error {
+	opts.SourceFile, opts.SourceFormat, opts.Build = inFile, inFormat, data.Build
+	if opts.Build == "" {
+		build, err := internal.DetectBuild(data.Records)
+		if err != nil {
+			return err
+		}
+		opts.Build = build
+	}
+	return nil
+}
 
+// writeOptions names the output sample after the output file unless
+// --sampleID is given.
+func writeOptions() (internal.WriteOptions, error) {
+	id := sampleID
+	if id == "" {
+		id = strings.TrimSuffix(filepath.Base(outFile), filepath.Ext(outFile))
+	}
+	sampleSex, err := internal.ParseSex(sex)
+	if err != nil {
+		return internal.WriteOptions{}, err
+	}
+	return internal.WriteOptions{
+		SampleID:   id,
+		FamilyID:   familyID,
+		Sex:        sampleSex,
+		Population: population,
+	}, nil
+}
+
+// printInputOptions prints the help lines of the flags shared by the
+// commands that read a kit.
+func printInputOptions(cmd *cobra.Command) {
+	fmt.Fprintln(cmd.OutOrStdout(), "  --sample NAME               Select the sample to read from a multi-sample file")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (e.g., a VCF sample or the IID of a PLINK .fam)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --indels RULE               Handle VCF indel sites")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: skip, keep; kept indels are coded D/I)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --multiAllelic RULE         Handle VCF multi-allelic sites")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: skip, keep)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --minGQ N, --minDP N        Treat gVCF reference blocks below this GQ or depth")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              as missing (default: 0, keep all blocks)")
+	printPseudoHaploidOption(cmd)
+	printStrictOption(cmd)
+	fmt.Fprintln(cmd.OutOrStdout(), "  --rsidMap FILE              Translate internal IDs such as 23andMe i-numbers to rsIDs")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (two columns: internal ID, rsID)")
+}
+
+func printStrictOption(cmd *cobra.Command) {
+	fmt.Fprintln(cmd.OutOrStdout(), "  --strict                    Stop at the first malformed input line instead of")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              skipping it and listing it at the end")
+}
+
+func printPseudoHaploidOption(cmd *cobra.Command) {
+	fmt.Fprintln(cmd.OutOrStdout(), "  --pseudoHaploid RULE        Handle EIGENSTRAT individuals without heterozygous calls")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (options: error, homozygous, haploid, diploid; default: error)")
+}
+
+// printOutputOptions prints the help lines of the flags shared by the
+// commands that write a kit.
+func printOutputOptions(cmd *cobra.Command) {
+	fmt.Fprintln(cmd.OutOrStdout(), "  --sampleID ID               Name of the sample in the output")
+	fmt.Fprintln(cmd.OutOrStdout(), "                              (default: the output file name)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --familyID ID               Family ID in PLINK output (default: the sample ID)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --sex SEX                   Sex of the sample (options: male, female, unknown)")
+	fmt.Fprintln(cmd.OutOrStdout(), "  --population LABEL          Population label in EIGENSTRAT .ind output")
+}
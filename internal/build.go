@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"iter"
+)
+
+// Markers near the start of chromosome 1 whose positions tell the genome
+// builds apart, by position
+var buildMarkers = map[string]map[string]string{
+	"rs3094315":  {"742429": "36", "752566": "37", "817186": "38"},
+	"rs3131972":  {"742584": "36", "752721": "37", "817341": "38"},
+	"rs12124819": {"766409": "36", "776546": "37", "841166": "38"},
+	"rs11240777": {"788822": "36", "798959": "37", "863579": "38"},
+}
+
+// Number of records read while looking for a marker
+const buildScanLimit = 5000
+
+// markerBuild returns the build a marker position belongs to, or "".
+func markerBuild(rsid, position string) string {
+	return buildMarkers[rsid][position]
+}
+
+// DetectBuild guesses the genome build of a kit from the positions of a few
+// markers among its first records. It returns "" when none of them is found.
+func DetectBuild(records iter.Seq2[DNARecord, error]) (string, error) {
+	n := 0
+	for record, err := range records {
+		if err != nil {
+			return "", err
+		}
+		if build := markerBuild(record.RSID, record.Position); build != "" {
+			return build, nil
+		}
+		if n++; n >= buildScanLimit {
+			break
+		}
+	}
+	return "", nil
+}
+
+// DetectTemplateBuild is DetectBuild for the sites of a template.
+func DetectTemplateBuild(templateRecords iter.Seq2[TemplateRecord, error]) (string, error) {
+	n := 0
+	for template, err := range templateRecords {
+		if err != nil {
+			return "", err
+		}
+		if build := markerBuild(template.RSID, template.Position); build != "" {
+			return build, nil
+		}
+		if n++; n >= buildScanLimit {
+			break
+		}
+	}
+	return "", nil
+}
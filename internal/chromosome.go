@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"strings"
+)
+
+// Chromosome is a canonical chromosome name: 1 to 22, X, Y, XY for the
+// pseudo-autosomal region, MT, or the contig name for anything else. Parsers
+// map every vendor label into it, and writers render it in their own
+// convention.
+type Chromosome string
+
+const (
+	ChrX  Chromosome = "X"
+	ChrY  Chromosome = "Y"
+	ChrXY Chromosome = "XY"
+	ChrMT Chromosome = "MT"
+)
+
+// ParseChromosome reads the labels used by vendors and tools: the numeric
+// codes 23 to 26 of PLINK and Ancestry, 90 and 91 of EIGENSTRAT, M for MT and
+// the chr prefix of UCSC-style references.
+func ParseChromosome(s string) Chromosome {
+	if len(s) > 3 && strings.EqualFold(s[:3], "chr") {
+		s = s[3:]
+	}
+	// Oxford files may pad the number, as in 01
+	if trimmed := strings.TrimLeft(s, "0"); trimmed != "" {
+		s = trimmed
+	}
+	switch strings.ToUpper(s) {
+		case "23", "X":
+			return ChrX
+		case "24", "Y":
+			return ChrY
+		case "25", "91", "XY", "PAR":
+			return ChrXY
+		case "26", "90", "M", "MT":
+			return ChrMT
+	}
+	return Chromosome(s)
+}
+
+func (c Chromosome) String() string {
+	return string(c)
+}
+
+// numeric renders X, Y, XY and MT as 23, 24, 25 and 26, as PLINK and
+// Ancestry do.
+func (c Chromosome) numeric() string {
+	switch c {
+		case ChrX:
+			return "23"
+		case ChrY:
+			return "24"
+		case ChrXY:
+			return "25"
+		case ChrMT:
+			return "26"
+	}
+	return string(c)
+}
+
+// eigenstrat renders the codes of EIGENSTRAT .snp files: 23 and 24 for X and
+// Y, 90 for MT and 91 for XY.
+func (c Chromosome) eigenstrat() string {
+	switch c {
+		case ChrX:
+			return "23"
+		case ChrY:
+			return "24"
+		case ChrXY:
+			return "91"
+		case ChrMT:
+			return "90"
+	}
+	return string(c)
+}
+
+// letters renders the pseudo-autosomal region as X, for the vendors and
+// references that have no XY.
+func (c Chromosome) letters() string {
+	if c == ChrXY {
+		return string(ChrX)
+	}
+	return string(c)
+}
@@ -1,17 +1,151 @@
 package internal
 
+import (
+	"fmt"
+	"iter"
+	"strings"
+)
+
 type DNARecord struct {
 	RSID        string
-	Chromosome  string
+	Chromosome  Chromosome
 	Position    string
 	Allele1     string
 	Allele2     string
 	RawGenotype string
+	// End is the last position of a gVCF reference block starting at
+	// Position, and empty for ordinary records
+	End string
+	// Status tells how align filled the record, and is empty otherwise
+	Status string
+	// Ploidy is 1 for haploid calls, such as X and Y in males or MT, and 2
+	// for diploid ones; 0 when the source does not tell. Haploid calls keep
+	// the allele in both Allele1 and Allele2.
+	Ploidy int
 }
 
+// Alignment status of a record
+const (
+	StatusMatched = "matched"
+	StatusFlipped = "flipped"
+	StatusFilled  = "filled"
+	StatusMissing = "missing"
+)
+
+// DNAData streams the records of a kit. The sequence can be iterated more
+// than once; each iteration reads the source again.
 type DNAData struct {
-	Records []DNARecord
+	Records iter.Seq2[DNARecord, error]
 	Format  string
+	// Build is the genome build of the positions ("36", "37", "38"), and
+	// Version the version of the file layout, where the parser knows them
+	Build   string
+	Version string
+}
+
+// ParseOptions holds the settings of the parsers that need them. Formats
+// ignore the fields that do not apply to them.
+type ParseOptions struct {
+	// Sample picks one sample out of a multi-sample file such as a VCF
+	Sample string
+	// VCF sites that are not biallelic SNPs: "skip" drops them, "keep" keeps
+	// them, coding indel alleles as D and I
+	Indels       string
+	MultiAllelic string
+	// gVCF reference blocks below these GQ and DP values are dropped, so the
+	// sites they cover count as missing
+	MinGQ int
+	MinDP int
+	// Strict makes the first malformed line fail the parse. Otherwise such
+	// lines are skipped and collected in Report, when it is set
+	Strict bool
+	Report *ParseReport
+	// How pseudo-haploid EIGENSTRAT samples are read: "error" refuses them,
+	// "homozygous" writes each call twice, "haploid" writes the calls as
+	// haploid and "diploid" skips the check
+	PseudoHaploid string
+}
+
+// WriteOptions holds the settings of the writers that need them.
+type WriteOptions struct {
+	// SampleID names the sample in formats with sample columns or files
+	SampleID string
+	FamilyID string
+	Sex      Sex
+	// Population label of EIGENSTRAT .ind files
+	Population string
+	// Where the kit came from, recorded by the sqlite output
+	SourceFile   string
+	SourceFormat string
+	Build        string
+}
+
+type Sex int
+
+const (
+	SexUnknown Sex = iota
+	SexMale
+	SexFemale
+)
+
+func ParseSex(s string) (Sex, error) {
+	switch strings.ToLower(s) {
+		case "", "u", "unknown", "0":
+			return SexUnknown, nil
+		case "m", "male", "1":
+			return SexMale, nil
+		case "f", "female", "2":
+			return SexFemale, nil
+		default:
+			return SexUnknown, fmt.Errorf("unsupported sex: %s (options: male, female, unknown)", s)
+	}
+}
+
+func (s Sex) String() string {
+	switch s {
+		case SexMale:
+			return "male"
+		case SexFemale:
+			return "female"
+		default:
+			return "unknown"
+	}
+}
+
+// eigenstratCode returns the sex letter of an .ind file.
+func (s Sex) eigenstratCode() string {
+	switch s {
+		case SexMale:
+			return "M"
+		case SexFemale:
+			return "F"
+		default:
+			return "U"
+	}
+}
+
+// oxfordCode returns the sex value of an Oxford .sample file.
+func (s Sex) oxfordCode() string {
+	switch s {
+		case SexMale:
+			return "1"
+		case SexFemale:
+			return "2"
+		default:
+			return "NA"
+	}
+}
+
+// plinkCode returns the PLINK sex code: 1 male, 2 female, 0 unknown.
+func (s Sex) plinkCode() string {
+	switch s {
+		case SexMale:
+			return "1"
+		case SexFemale:
+			return "2"
+		default:
+			return "0"
+	}
 }
 
 type ParseResult struct {
@@ -19,11 +153,67 @@ type ParseResult struct {
 	Err  error
 }
 
+// TemplateRecord is one site of an alignment template. Value is the genetic
+// position in cM, NaN when the template has none, and templates without
+// alleles such as a PLINK .map leave ReferenceA1 and ReferenceA2 empty.
+// KnownReference tells that ReferenceA1 is the genome reference allele, as
+// the format guarantees for REF of a .pvar or .vcf, a0 of a .legend and the
+// fifth column of an EIGENSTRAT .snp. A .bim does not: plink 1.9 puts the
+// minor allele in A1.
 type TemplateRecord struct {
-	Chromosome  string
-	RSID        string
-	Value       float64
-	Position    string
-	ReferenceA1 string
-	ReferenceA2 string
+	Chromosome     Chromosome
+	RSID           string
+	Value          float64
+	Position       string
+	ReferenceA1    string
+	ReferenceA2    string
+	KnownReference bool
+}
+
+// Deletion and insertion alleles of indel calls, as 23andMe and FTDNA code
+// them
+const (
+	AlleleDeletion  = "D"
+	AlleleInsertion = "I"
+)
+
+func isIndelAllele(allele string) bool {
+	return allele == AlleleDeletion || allele == AlleleInsertion
+}
+
+// hasAlleles reports whether the template names the alleles of the site.
+func (t TemplateRecord) hasAlleles() bool {
+	return t.ReferenceA1 != "" && t.ReferenceA2 != ""
+}
+
+// NoCall reports whether the record carries no usable genotype, either
+// because it was never called or because it is missing from the kit.
+func (r DNARecord) NoCall() bool {
+	return isMissingAllele(r.Allele1) || isMissingAllele(r.Allele2)
+}
+
+// genotypeOr returns the two alleles of the call, or the given no-call
+// token. Haploid calls are written doubled.
+func (r DNARecord) genotypeOr(noCall string) string {
+	if r.NoCall() {
+		return noCall
+	}
+	return r.Allele1 + r.Allele2
+}
+
+// haploidGenotypeOr is genotypeOr, with haploid calls written as a single
+// allele as 23andMe does.
+func (r DNARecord) haploidGenotypeOr(noCall string) string {
+	if r.haploid() && !r.NoCall() {
+		return r.Allele1
+	}
+	return r.genotypeOr(noCall)
+}
+
+func (r DNARecord) haploid() bool {
+	return r.Ploidy == 1
+}
+
+func isMissingAllele(allele string) bool {
+	return allele == "" || allele == "-" || allele == "0"
 }
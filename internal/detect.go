@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"io"
+	"fmt"
+	"bufio"
+	"strings"
+)
+
+// Number of lines read from the top of a file when sniffing its format, and
+// the longest line read; the head stops at the first longer line
+const (
+	sniffLines      = 64
+	sniffLineLength = 64 * 1024
+)
+
+type Detection struct {
+	Format     string
+	Confidence float64
+	RunnerUp   string
+}
+
+// DetectFormat reads the first lines of a file and asks every registered
+// format how well they match. The confidence is the best score, lowered when
+// another format scored close to it.
+func DetectFormat(filename string) (Detection, error) {
+	head, err := readHead(filename, sniffLines)
+	if err != nil {
+		return Detection{}, err
+	}
+
+	var best, second float64
+	var detection Detection
+	for _, name := range InputFormats() {
+		format := formats[name]
+		if format.Detect == nil {
+			continue
+		}
+		score := format.Detect(head)
+		if score > best {
+			second, detection.RunnerUp = best, detection.Format
+			best, detection.Format = score, name
+		} else if score > second {
+			second, detection.RunnerUp = score, name
+		}
+	}
+
+	if best < 0.2 {
+		return Detection{}, fmt.Errorf("could not detect the format of %s", filename)
+	}
+	detection.Confidence = best - second/2
+	return detection, nil
+}
+
+func readHead(filename string, n int) ([]string, error) {
+	file, err := OpenInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	var head []string
+	reader := bufio.NewReaderSize(file, sniffLineLength)
+	for len(head) < n {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Binary files such as a .bed may have no line break at all
+			head = append(head, string(line))
+			break
+		}
+		if len(line) > 0 {
+			head = append(head, strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading file: %v", err)
+		}
+	}
+	return head, nil
+}
+
+// hasBanner reports whether a comment line mentions the given vendor name.
+func hasBanner(head []string, name string) bool {
+	for _, line := range head {
+		if strings.HasPrefix(line, "#") && strings.Contains(strings.ToLower(line), strings.ToLower(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHeader reports whether the column header is present, with or without
+// a leading comment marker and quotes.
+func hasHeader(head []string, header string) bool {
+	for _, line := range head {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		if strings.ReplaceAll(line, "\"", "") == header {
+			return true
+		}
+	}
+	return false
+}
+
+// dataFraction returns the share of data lines accepted by match. Comments,
+// blank lines and column headers are not counted.
+func dataFraction(head []string, match func(line string) bool) float64 {
+	var total, matched int
+	for _, line := range head {
+		if strings.HasPrefix(line, "#") || line == "" || strings.HasPrefix(strings.ToLower(strings.Trim(line, "\"")), "rsid") {
+			continue
+		}
+		total++
+		if match(line) {
+			matched++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(matched) / float64(total)
+}
+
+func isGenotype(s string) bool {
+	return len(s) == 1 || len(s) == 2
+}
+
+// tabFields matches tab-separated lines with n columns whose last column is
+// accepted by last.
+func tabFields(n int, last func(string) bool) func(string) bool {
+	return func(line string) bool {
+		fields := strings.Split(line, "\t")
+		return len(fields) == n && last(fields[n-1])
+	}
+}
+
+// csvFields matches comma-separated lines with n columns, all quoted or all
+// unquoted.
+func csvFields(n int, quoted bool) func(string) bool {
+	return func(line string) bool {
+		fields := strings.Split(line, ",")
+		if len(fields) != n {
+			return false
+		}
+		for _, field := range fields {
+			isQuoted := len(field) >= 2 && strings.HasPrefix(field, "\"") && strings.HasSuffix(field, "\"")
+			if isQuoted != quoted {
+				return false
+			}
+		}
+		return isGenotype(strings.Trim(fields[n-1], "\""))
+	}
+}
+
+func boolScore(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"path/filepath"
+)
+
+// RecordWriter renders DNA records in an output format.
+type RecordWriter interface {
+	Write(record DNARecord) error
+	Close() error
+}
+
+// TemplateWriter is implemented by writers that use the alignment template,
+// for example to take REF and ALT from its alleles. AlignDNA calls
+// WriteTemplate instead of Write on them.
+type TemplateWriter interface {
+	WriteTemplate(template TemplateRecord, record DNARecord) error
+}
+
+// Aborter is implemented by writers that can undo a partial output, such as
+// the sqlite output rolling back its transaction. On an error the commands
+// call Abort instead of Close on them.
+type Aborter interface {
+	Abort() error
+}
+
+// abortWriter closes the writer of a failed run, undoing its output when the
+// writer can.
+func abortWriter(writer RecordWriter) {
+	if aborter, ok := writer.(Aborter); ok {
+		aborter.Abort()
+		return
+	}
+	writer.Close()
+}
+
+// Format describes a vendor or tool format. Parse is nil for write-only
+// formats and NewWriter is nil for read-only formats. Detect scores the first
+// lines of a file between 0 and 1 and is used by DetectFormat.
+type Format struct {
+	Name      string
+	Parse     func(filename string, opts ParseOptions) ParseResult
+	NewWriter func(outFile string, opts WriteOptions) (RecordWriter, error)
+	Detect    func(head []string) float64
+}
+
+var formats = make(map[string]Format)
+
+// RegisterFormat makes a format available to the commands. It is meant to be
+// called from the init function of the file implementing the format.
+func RegisterFormat(format Format) {
+	if _, exists := formats[format.Name]; exists {
+		panic("format registered twice: " + format.Name)
+	}
+	formats[format.Name] = format
+}
+
+func LookupFormat(name string) (Format, bool) {
+	format, exists := formats[name]
+	return format, exists
+}
+
+// InputFormats returns the sorted names of all formats that can be read.
+func InputFormats() []string {
+	var names []string
+	for name, format := range formats {
+		if format.Parse != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OutputFormats returns the sorted names of all formats that can be written.
+func OutputFormats() []string {
+	var names []string
+	for name, format := range formats {
+		if format.NewWriter != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Parse(filename string, inFormat string, opts ParseOptions) ParseResult {
+	format, exists := LookupFormat(inFormat)
+	if !exists || format.Parse == nil {
+		return ParseResult{Err: fmt.Errorf("unsupported input format: %s", inFormat)}
+	}
+	return format.Parse(filename, opts)
+}
+
+func NewWriter(outFile string, outFormat string, opts WriteOptions) (RecordWriter, error) {
+	format, exists := LookupFormat(outFormat)
+	if !exists || format.NewWriter == nil {
+		return nil, fmt.Errorf("unsupported output format: %s", outFormat)
+	}
+	return format.NewWriter(outFile, opts)
+}
+
+// textWriter writes a header followed by one line per record.
+type textWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	line func(record DNARecord) string
+}
+
+func newTextWriter(outFile string, header string, line func(record DNARecord) string) (RecordWriter, error) {
+	file, err := os.Create(outFile)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+
+	w := &textWriter{file: file, buf: bufio.NewWriter(file), line: line}
+	if _, err := w.buf.WriteString(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error writing output file: %v", err)
+	}
+	return w, nil
+}
+
+func (w *textWriter) Write(record DNARecord) error {
+	if _, err := w.buf.WriteString(w.line(record)); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *textWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return w.file.Close()
+}
+
+// outputFile is a buffered output file, for formats that write several files
+// side by side.
+type outputFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+func createOutput(filename string) (*outputFile, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+	return &outputFile{Writer: bufio.NewWriter(file), file: file}, nil
+}
+
+func (f *outputFile) Close() error {
+	if err := f.Flush(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("error writing %s: %v", f.file.Name(), err)
+	}
+	return f.file.Close()
+}
+
+// createOutputs creates prefix+ext for every extension. Nothing is left open
+// when one of them fails.
+func createOutputs(prefix string, exts ...string) ([]*outputFile, error) {
+	var files []*outputFile
+	for _, ext := range exts {
+		file, err := createOutput(prefix + ext)
+		if err != nil {
+			closeOutputs(files)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// closeOutputs closes every file and returns the first error.
+func closeOutputs(files []*outputFile) error {
+	var firstErr error
+	for _, file := range files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// outputPrefix strips one of the given extensions from an output path, so
+// "kit.bed" and "kit" both name the dataset "kit".
+func outputPrefix(outFile string, exts ...string) string {
+	ext := filepath.Ext(outFile)
+	for _, known := range exts {
+		if strings.EqualFold(ext, known) {
+			return strings.TrimSuffix(outFile, ext)
+		}
+	}
+	return outFile
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "23andme",
+		Parse:     Parse23andMe,
+		NewWriter: new23andMeWriter,
+		Detect:    detect23andMe,
+	})
+}
+
+func detect23andMe(head []string) float64 {
+	return 0.4*dataFraction(head, tabFields(4, isGenotype)) +
+		0.35*boolScore(hasBanner(head, "23andMe")) +
+		0.25*boolScore(hasHeader(head, "rsid\tchromosome\tposition\tgenotype"))
+}
+
+func Parse23andMe(filename string, opts ParseOptions) ParseResult {
+	return ParseResult{
+		Data: DNAData{
+			Records: scanRecords(filename, opts, parse23andMeLine),
+			Format:  "23andme",
+		},
+	}
+}
+
+func parse23andMeLine(line string) (DNARecord, bool, *ParseError) {
+	if strings.HasPrefix(line, "#") || line == "" {
+		return DNARecord{}, false, nil
+	}
+	if line == "rsid\tchromosome\tposition\tgenotype" {
+		return DNARecord{}, false, nil
+	}
+
+	fields := strings.Split(line, "\t")
+	return genotypeLine(fields)
+}
+
+func new23andMeWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	return newTextWriter(outFile, "# rsid\tchromosome\tposition\tgenotype\n", func(record DNARecord) string {
+		return fmt.Sprintf("%s\t%s\t%s\t%s\n",
+			record.RSID, record.Chromosome.letters(), record.Position, record.haploidGenotypeOr("--"))
+	})
+}
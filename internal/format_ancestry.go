@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"strconv"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "ancestry",
+		Parse:     ParseAncestryDNA,
+		NewWriter: newAncestryWriter,
+		Detect:    detectAncestryDNA,
+	})
+}
+
+func detectAncestryDNA(head []string) float64 {
+	return 0.4*dataFraction(head, tabFields(5, isAllele)) +
+		0.35*boolScore(hasBanner(head, "AncestryDNA")) +
+		0.25*boolScore(hasHeader(head, "rsid\tchromosome\tposition\tallele1\tallele2"))
+}
+
+func isAllele(s string) bool {
+	return len(s) == 1
+}
+
+func ParseAncestryDNA(filename string, opts ParseOptions) ParseResult {
+	return ParseResult{
+		Data: DNAData{
+			Records: scanRecords(filename, opts, parseAncestryLine),
+			Format:  "ancestry",
+		},
+	}
+}
+
+func parseAncestryLine(line string) (DNARecord, bool, *ParseError) {
+	if strings.HasPrefix(line, "#") || line == "" {
+		return DNARecord{}, false, nil
+	}
+	if line == "rsid\tchromosome\tposition\tallele1\tallele2" {
+		return DNARecord{}, false, nil
+	}
+
+	fields := strings.Split(line, "\t")
+	if problem := fieldCountProblem(fields, 5); problem != nil {
+		return DNARecord{}, false, problem
+	}
+	if _, err := strconv.Atoi(fields[2]); err != nil {
+		return DNARecord{}, false, &ParseError{Column: 3, Reason: fmt.Sprintf("invalid position %q", fields[2])}
+	}
+	for i, allele := range fields[3:5] {
+		if allele == "" {
+			return DNARecord{}, false, &ParseError{Column: 4 + i, Reason: "empty allele"}
+		}
+	}
+	return DNARecord{
+		RSID:        fields[0],
+		Chromosome:  ParseChromosome(fields[1]),
+		Position:    fields[2],
+		Allele1:     fields[3],
+		Allele2:     fields[4],
+		RawGenotype: fields[3] + fields[4],
+	}, true, nil
+}
+
+func newAncestryWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	return newTextWriter(outFile, "# rsid\tchromosome\tposition\tallele1\tallele2\n", func(record DNARecord) string {
+		allele1, allele2 := record.Allele1, record.Allele2
+		if record.NoCall() {
+			// Ancestry format uses 0 for missing data
+			allele1, allele2 = "0", "0"
+		}
+		return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n",
+			record.RSID, record.Chromosome.numeric(), record.Position, allele1, allele2)
+	})
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"fmt"
+	"bytes"
+	"strconv"
+	"compress/zlib"
+	"encoding/binary"
+)
+
+// BGEN header flags: zlib compressed genotype blocks, layout 2 and sample
+// identifiers stored in the file
+const bgenFlags = 1 | 2<<2 | 1<<31
+
+// Bits per stored probability
+const bgenBits = 8
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "bgen",
+		NewWriter: newBgenWriter,
+	})
+}
+
+// bgenWriter writes a single-sample BGEN v1.2 file, layout 2, with a .sample
+// file alongside for the tools that ask for one. The header holds the variant
+// count, so it is written again on Close.
+type bgenWriter struct {
+	bgen     *outputFile
+	sample   *outputFile
+	sampleID string
+	variants uint32
+	buf      bytes.Buffer
+	zbuf     bytes.Buffer
+	zw       *zlib.Writer
+}
+
+func newBgenWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	files, err := createOutputs(outputPrefix(outFile, ".bgen", ".sample"), ".bgen", ".sample")
+	if err != nil {
+		return nil, err
+	}
+	w := &bgenWriter{bgen: files[0], sample: files[1], sampleID: opts.SampleID}
+	w.zw = zlib.NewWriter(&w.zbuf)
+
+	w.bgen.Write(w.header())
+	writeOxfordSample(w.sample, opts)
+	return w, nil
+}
+
+// header returns the offset, the header block and the sample identifier block.
+func (w *bgenWriter) header() []byte {
+	const headerLength = 20
+	sampleBlockLength := 8 + 2 + len(w.sampleID)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(headerLength+sampleBlockLength))
+	binary.Write(&b, binary.LittleEndian, uint32(headerLength))
+	binary.Write(&b, binary.LittleEndian, w.variants)
+	binary.Write(&b, binary.LittleEndian, uint32(1))
+	b.WriteString("bgen")
+	binary.Write(&b, binary.LittleEndian, uint32(bgenFlags))
+
+	binary.Write(&b, binary.LittleEndian, uint32(sampleBlockLength))
+	binary.Write(&b, binary.LittleEndian, uint32(1))
+	binary.Write(&b, binary.LittleEndian, uint16(len(w.sampleID)))
+	b.WriteString(w.sampleID)
+	return b.Bytes()
+}
+
+func (w *bgenWriter) Write(record DNARecord) error {
+	a1, a2 := callAlleles(record)
+	return w.writeVariant(record, a1, a2)
+}
+
+func (w *bgenWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	if !template.hasAlleles() {
+		return w.Write(record)
+	}
+	return w.writeVariant(record, template.ReferenceA1, template.ReferenceA2)
+}
+
+func (w *bgenWriter) writeVariant(record DNARecord, a1, a2 string) error {
+	position, err := strconv.ParseUint(record.Position, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid position %q for %s", record.Position, record.RSID)
+	}
+
+	// Variant identifying data
+	w.buf.Reset()
+	writeBgenString16(&w.buf, record.RSID)
+	writeBgenString16(&w.buf, record.RSID)
+	writeBgenString16(&w.buf, record.Chromosome.String())
+	binary.Write(&w.buf, binary.LittleEndian, uint32(position))
+	binary.Write(&w.buf, binary.LittleEndian, uint16(2))
+	writeBgenString32(&w.buf, a1)
+	writeBgenString32(&w.buf, a2)
+
+	// Genotype data: sample count, allele count, ploidy range, ploidy and
+	// missingness of each sample, phasing, bits per probability, then the
+	// probabilities of a1/a1 and a1/a2 (a2/a2 is implied), or for a haploid
+	// call the probability of a1
+	probabilities := genotypeProbabilities(record, a1, a2)
+	ploidy := byte(2)
+	if record.haploid() {
+		ploidy = 1
+	}
+	missing := byte(0)
+	if probabilities == [3]int{} {
+		missing = 0x80
+	}
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, uint32(1))
+	binary.Write(&data, binary.LittleEndian, uint16(2))
+	data.Write([]byte{ploidy, ploidy, ploidy | missing, 0, bgenBits})
+	if ploidy == 1 {
+		data.Write([]byte{byte(probabilities[0] * 255)})
+	} else {
+		data.Write([]byte{byte(probabilities[0] * 255), byte(probabilities[1] * 255)})
+	}
+
+	w.zbuf.Reset()
+	w.zw.Reset(&w.zbuf)
+	w.zw.Write(data.Bytes())
+	if err := w.zw.Close(); err != nil {
+		return fmt.Errorf("error compressing genotypes: %v", err)
+	}
+	binary.Write(&w.buf, binary.LittleEndian, uint32(w.zbuf.Len()+4))
+	binary.Write(&w.buf, binary.LittleEndian, uint32(data.Len()))
+	w.buf.Write(w.zbuf.Bytes())
+
+	if _, err := w.bgen.Write(w.buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	w.variants++
+	return nil
+}
+
+func (w *bgenWriter) Close() error {
+	if err := w.bgen.Flush(); err != nil {
+		closeOutputs([]*outputFile{w.bgen, w.sample})
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	if _, err := w.bgen.file.WriteAt(w.header(), 0); err != nil {
+		closeOutputs([]*outputFile{w.bgen, w.sample})
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return closeOutputs([]*outputFile{w.bgen, w.sample})
+}
+
+func writeBgenString16(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.LittleEndian, uint16(len(s)))
+	b.WriteString(s)
+}
+
+func writeBgenString32(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.LittleEndian, uint32(len(s)))
+	b.WriteString(s)
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+	"compress/zlib"
+	"encoding/binary"
+)
+
+// bgenBlock returns the lengths and the zlib stream of a genotype block, as
+// they follow the alleles of a variant.
+func bgenBlock(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(compressed.Len()+4))
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(compressed.Bytes())
+	return b.Bytes()
+}
+
+func TestBgenWriter(t *testing.T) {
+	prefix := writeTestRecords(t, "bgen")
+
+	var want bytes.Buffer
+	want.Write([]byte{
+		0x20, 0x00, 0x00, 0x00, // offset of the first variant
+		0x14, 0x00, 0x00, 0x00, // header length
+		0x03, 0x00, 0x00, 0x00, // variants
+		0x01, 0x00, 0x00, 0x00, // samples
+		'b', 'g', 'e', 'n',
+		0x09, 0x00, 0x00, 0x80, // zlib, layout 2, sample identifiers
+		0x0c, 0x00, 0x00, 0x00, // sample block length
+		0x01, 0x00, 0x00, 0x00, // samples
+		0x02, 0x00, 's', '1',
+	})
+
+	// rs1: heterozygous for A and G
+	want.Write([]byte{
+		0x03, 0x00, 'r', 's', '1', 0x03, 0x00, 'r', 's', '1', 0x01, 0x00, '1',
+		0x64, 0x00, 0x00, 0x00, 0x02, 0x00,
+		0x01, 0x00, 0x00, 0x00, 'A', 0x01, 0x00, 0x00, 0x00, 'G',
+	})
+	want.Write(bgenBlock(t, []byte{
+		0x01, 0x00, 0x00, 0x00, 0x02, 0x00, // samples, alleles
+		0x02, 0x02, 0x02, 0x00, 0x08, // ploidy range and ploidy, unphased, 8 bits
+		0x00, 0xff, // P(A/A), P(A/G)
+	}))
+
+	// rs2: haploid A, with 0 for the unknown first allele
+	want.Write([]byte{
+		0x03, 0x00, 'r', 's', '2', 0x03, 0x00, 'r', 's', '2', 0x01, 0x00, 'X',
+		0xc8, 0x00, 0x00, 0x00, 0x02, 0x00,
+		0x01, 0x00, 0x00, 0x00, '0', 0x01, 0x00, 0x00, 0x00, 'A',
+	})
+	want.Write(bgenBlock(t, []byte{
+		0x01, 0x00, 0x00, 0x00, 0x02, 0x00,
+		0x01, 0x01, 0x01, 0x00, 0x08,
+		0x00, // P(0)
+	}))
+
+	// rs3: missing
+	want.Write([]byte{
+		0x03, 0x00, 'r', 's', '3', 0x03, 0x00, 'r', 's', '3', 0x01, 0x00, '1',
+		0x2c, 0x01, 0x00, 0x00, 0x02, 0x00,
+		0x01, 0x00, 0x00, 0x00, '0', 0x01, 0x00, 0x00, 0x00, '0',
+	})
+	want.Write(bgenBlock(t, []byte{
+		0x01, 0x00, 0x00, 0x00, 0x02, 0x00,
+		0x02, 0x02, 0x82, 0x00, 0x08, // missing flag on the sample's ploidy
+		0x00, 0x00,
+	}))
+
+	checkFile(t, prefix+".bgen", want.Bytes())
+	checkFile(t, prefix+".sample", []byte("ID_1 ID_2 missing sex\n0 0 0 D\ns1 s1 0 1\n"))
+}
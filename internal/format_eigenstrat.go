@@ -0,0 +1,381 @@
+package internal
+
+import (
+	"io"
+	"fmt"
+	"bufio"
+	"strings"
+	"strconv"
+)
+
+// EIGENSTRAT genotype value of a call that is not usable
+const eigenstratMissing = 9
+
+// Number of called sites inspected when checking for pseudo-haploid data
+const pseudoHaploidSites = 10000
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "eigenstrat",
+		Parse:     ParseEigenstrat,
+		NewWriter: newEigenstratWriter,
+		Detect:    detectEigenstrat,
+	})
+}
+
+// detectEigenstrat recognises a text .geno, where every line is a row of
+// 0, 1, 2 and 9.
+func detectEigenstrat(head []string) float64 {
+	return 0.8 * dataFraction(head, func(line string) bool {
+		return line != "" && strings.Trim(line, "0129") == ""
+	})
+}
+
+// ParseEigenstrat reads one individual of an EIGENSTRAT or PACKEDANCESTRYMAP
+// dataset; the layout of the .geno is recognised from its header. The
+// filename may be any of the .geno, .snp and .ind files or their common
+// prefix, and opts.Sample is the ID of the individual in the .ind file.
+//
+// Ancient samples are often pseudo-haploid: one read is sampled per site and
+// written as a homozygous call. Such a sample is refused unless
+// opts.PseudoHaploid says how to handle it.
+func ParseEigenstrat(filename string, opts ParseOptions) ParseResult {
+	prefix := outputPrefix(filename, ".geno", ".snp", ".ind")
+	index, individuals, err := indSampleIndex(prefix+".ind", opts)
+	if err != nil {
+		return ParseResult{Err: err}
+	}
+
+	switch opts.PseudoHaploid {
+		case "", "error":
+			pseudoHaploid, err := isPseudoHaploid(prefix, index, individuals)
+			if err != nil {
+				return ParseResult{Err: err}
+			}
+			if pseudoHaploid {
+				return ParseResult{Err: fmt.Errorf("sample %s looks pseudo-haploid (no heterozygous calls), choose how to write it with --pseudoHaploid (options: homozygous, haploid, diploid)", opts.Sample)}
+			}
+		case "homozygous", "haploid", "diploid":
+			// Calls are read as they are stored, as homozygous genotypes
+		default:
+			return ParseResult{Err: fmt.Errorf("unsupported pseudo-haploid mode: %s (options: error, homozygous, haploid, diploid)", opts.PseudoHaploid)}
+	}
+
+	return ParseResult{
+		Data: DNAData{
+			Records: genoRecords(prefix, index, individuals, opts),
+			Format:  "eigenstrat",
+		},
+	}
+}
+
+// indSampleIndex returns the position of the individual in the .ind file and
+// the number of individuals. A malformed line still stands for an individual
+// of the .geno.
+func indSampleIndex(indFile string, opts ParseOptions) (int, int, error) {
+	sample := opts.Sample
+	if sample == "" {
+		return 0, 0, fmt.Errorf("choose the individual to read with --sample")
+	}
+
+	file, err := OpenInput(indFile)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	index := -1
+	var individuals int
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if problem := fieldCountProblem(fields, 3); problem != nil {
+			problem.File, problem.Line = indFile, lineNumber
+			if err := reportProblem(*problem, opts); err != nil {
+				return 0, 0, err
+			}
+		}
+		if index < 0 && fields[0] == sample {
+			index = individuals
+		}
+		individuals++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error reading file: %v", err)
+	}
+	if index < 0 {
+		return 0, 0, fmt.Errorf("individual %s not found in %s", sample, indFile)
+	}
+	return index, individuals, nil
+}
+
+// isPseudoHaploid reports whether the first called sites of the individual
+// hold no heterozygous genotype.
+func isPseudoHaploid(prefix string, index, individuals int) (bool, error) {
+	geno, err := openGeno(prefix+".geno", index, individuals)
+	if err != nil {
+		return false, err
+	}
+	defer geno.Close()
+
+	called := 0
+	for called < pseudoHaploidSites {
+		genotype, err := geno.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		switch genotype {
+			case 1:
+				return false, nil
+			case 0, 2:
+				called++
+		}
+	}
+	return called > 0, nil
+}
+
+// genoRecords walks the .snp and the .geno side by side. The genotype is the
+// number of copies of the reference allele, the fifth column of the .snp.
+// In the "haploid" pseudo-haploid mode, homozygous calls are read as haploid.
+func genoRecords(prefix string, index, individuals int, opts ParseOptions) func(yield func(DNARecord, error) bool) {
+	return func(yield func(DNARecord, error) bool) {
+		snp, err := OpenInput(prefix + ".snp")
+		if err != nil {
+			yield(DNARecord{}, fmt.Errorf("error opening file: %v", err))
+			return
+		}
+		defer snp.Close()
+		geno, err := openGeno(prefix+".geno", index, individuals)
+		if err != nil {
+			yield(DNARecord{}, err)
+			return
+		}
+		defer geno.Close()
+
+		scanner := bufio.NewScanner(snp)
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			genotype, err := geno.next()
+			if err != nil {
+				yield(DNARecord{}, fmt.Errorf("%s.geno does not match %s.snp: %v", prefix, prefix, err))
+				return
+			}
+			// A malformed variant still has its row in the .geno, read above
+			if problem := fieldCountProblem(fields, 6); problem != nil {
+				problem.File, problem.Line = prefix+".snp", lineNumber
+				if !handleProblem(*problem, opts, yield) {
+					return
+				}
+				continue
+			}
+
+			ref, alt := fields[4], fields[5]
+			var allele1, allele2 string
+			switch genotype {
+				case 2:
+					allele1, allele2 = ref, ref
+				case 1:
+					allele1, allele2 = ref, alt
+				case 0:
+					allele1, allele2 = alt, alt
+				default:
+					allele1, allele2 = "-", "-"
+			}
+
+			record := DNARecord{
+				RSID:        fields[0],
+				Chromosome:  ParseChromosome(fields[1]),
+				Position:    fields[3],
+				Allele1:     allele1,
+				Allele2:     allele2,
+				RawGenotype: allele1 + allele2,
+				Ploidy:      2,
+			}
+			if opts.PseudoHaploid == "haploid" && genotype != 1 {
+				record.Ploidy = 1
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(DNARecord{}, fmt.Errorf("error reading file: %v", err))
+		}
+	}
+}
+
+// genoReader reads the genotypes of one individual from successive SNPs of
+// a text or packed .geno file.
+type genoReader struct {
+	io.Closer
+	reader *bufio.Reader
+	index  int
+	record []byte // nil for text files
+}
+
+func openGeno(filename string, index, individuals int) (*genoReader, error) {
+	file, err := OpenInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	g := &genoReader{Closer: file, reader: bufio.NewReader(file), index: index}
+
+	magic, _ := g.reader.Peek(5)
+	switch {
+		case string(magic) == "TGENO":
+			file.Close()
+			return nil, fmt.Errorf("transposed packed .geno files are not supported")
+		case strings.HasPrefix(string(magic), "GENO"):
+			g.record = make([]byte, max(packedRecordLength, (individuals+3)/4))
+			if _, err := io.ReadFull(g.reader, g.record); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("error reading %s: %v", filename, err)
+			}
+			header := strings.Fields(string(g.record))
+			if len(header) < 3 || header[1] != strconv.Itoa(individuals) {
+				file.Close()
+				return nil, fmt.Errorf("%s does not hold %d individuals", filename, individuals)
+			}
+	}
+	return g, nil
+}
+
+// next returns the genotype at the next SNP: 0, 1, 2, or 9 when missing.
+func (g *genoReader) next() (int, error) {
+	if g.record != nil {
+		if _, err := io.ReadFull(g.reader, g.record); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return 0, fmt.Errorf("truncated .geno record")
+			}
+			return 0, err
+		}
+		// The first individual sits in the two high bits of the first byte
+		genotype := int(g.record[g.index/4]>>(2*(3-g.index%4))) & 0x3
+		if genotype == packedMissing {
+			return eigenstratMissing, nil
+		}
+		return genotype, nil
+	}
+
+	line, err := g.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return 0, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if g.index >= len(line) {
+		return 0, fmt.Errorf(".geno line has %d individuals", len(line))
+	}
+	switch line[g.index] {
+		case '0', '1', '2':
+			return int(line[g.index] - '0'), nil
+		default:
+			return eigenstratMissing, nil
+	}
+}
+
+// eigenstratWriter writes a single-sample EIGENSTRAT dataset. The .geno holds
+// one line per SNP with the number of reference alleles, in .snp order.
+type eigenstratWriter struct {
+	geno *outputFile
+	snp  *outputFile
+	ind  *outputFile
+}
+
+func newEigenstratWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	files, err := createOutputs(outputPrefix(outFile, ".geno", ".snp", ".ind"), ".geno", ".snp", ".ind")
+	if err != nil {
+		return nil, err
+	}
+	w := &eigenstratWriter{geno: files[0], snp: files[1], ind: files[2]}
+	writeIndLine(w.ind, opts)
+	return w, nil
+}
+
+// Write is used by convert. Without a template the first allele of the call
+// is taken as the reference, and X marks an unknown variant allele.
+func (w *eigenstratWriter) Write(record DNARecord) error {
+	ref, alt := eigenstratAlleles(record)
+	return w.writeSNP(record, 0, ref, alt)
+}
+
+// WriteTemplate copies the .snp line of the template, taking the alleles
+// from the call when the template has none.
+func (w *eigenstratWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	if !template.hasAlleles() {
+		ref, alt := eigenstratAlleles(record)
+		return w.writeSNP(record, template.Value, ref, alt)
+	}
+	return w.writeSNP(record, template.Value, template.ReferenceA1, template.ReferenceA2)
+}
+
+func (w *eigenstratWriter) writeSNP(record DNARecord, cM float64, ref, alt string) error {
+	writeSnpLine(w.snp, record, cM, ref, alt)
+	if _, err := fmt.Fprintf(w.geno, "%d\n", eigenstratGenotype(record, ref, alt)); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *eigenstratWriter) Close() error {
+	return closeOutputs([]*outputFile{w.geno, w.snp, w.ind})
+}
+
+func eigenstratAlleles(record DNARecord) (string, string) {
+	ref, alt := record.Allele1, record.Allele2
+	if record.NoCall() {
+		return "X", "X"
+	}
+	if alt == ref {
+		alt = "X"
+	}
+	return ref, alt
+}
+
+// eigenstratGenotype counts the copies of the reference allele. Calls with
+// an allele that is neither the reference nor the variant are missing.
+func eigenstratGenotype(record DNARecord, ref, alt string) int {
+	if record.NoCall() {
+		return eigenstratMissing
+	}
+	count := 0
+	for _, allele := range []string{record.Allele1, record.Allele2} {
+		switch allele {
+			case ref:
+				count++
+			case alt:
+			default:
+				return eigenstratMissing
+		}
+	}
+	return count
+}
+
+// writeSnpLine writes an EIGENSTRAT .snp line: ID, chromosome, genetic
+// position, physical position, reference and variant allele.
+func writeSnpLine(snp *outputFile, record DNARecord, cM float64, ref, alt string) {
+	fmt.Fprintf(snp, "%20s %4s %15s %15s %s %s\n",
+		record.RSID, record.Chromosome.eigenstrat(), formatGeneticPosition(cM), record.Position, ref, alt)
+}
+
+// writeIndLine writes the .ind line of the sample: ID, sex and population.
+func writeIndLine(ind *outputFile, opts WriteOptions) {
+	population := opts.Population
+	if population == "" {
+		population = "Unknown"
+	}
+	fmt.Fprintf(ind, "%20s %s %s\n", opts.SampleID, opts.Sex.eigenstratCode(), population)
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "ftdnav1",
+		Parse:     ParseFTDNAv1,
+		NewWriter: newQuotedCSVWriter,
+		Detect:    detectFTDNAv1,
+	})
+	RegisterFormat(Format{
+		Name:      "ftdnav2",
+		Parse:     ParseFTDNA,
+		NewWriter: newFTDNAWriter,
+		Detect:    detectFTDNAv2,
+	})
+}
+
+// FTDNA files carry no banner, so they are told apart by quoting alone. A
+// quoted file with a MyHeritage banner is left to the MyHeritage format.
+func detectFTDNAv1(head []string) float64 {
+	score := 0.6*dataFraction(head, csvFields(4, true)) +
+		0.25*boolScore(hasHeader(head, "RSID,CHROMOSOME,POSITION,RESULT"))
+	if hasBanner(head, "MyHeritage") {
+		score /= 2
+	}
+	return score
+}
+
+func detectFTDNAv2(head []string) float64 {
+	return 0.6*dataFraction(head, csvFields(4, false)) +
+		0.25*boolScore(hasHeader(head, "RSID,CHROMOSOME,POSITION,RESULT"))
+}
+
+// ParseFTDNAv1 reads the quoted layout of older Family Finder files, which
+// are on build 36.
+func ParseFTDNAv1(filename string, opts ParseOptions) ParseResult {
+	return parseFTDNA(filename, opts, "1", "36")
+}
+
+// ParseFTDNA reads the unquoted layout of later Family Finder files, which
+// are on build 37.
+func ParseFTDNA(filename string, opts ParseOptions) ParseResult {
+	return parseFTDNA(filename, opts, "2", "37")
+}
+
+// parseFTDNA reads either layout. The build is taken from the positions of
+// known markers, and from the file version when none of them is present.
+func parseFTDNA(filename string, opts ParseOptions, version, defaultBuild string) ParseResult {
+	records := scanRecords(filename, opts, parseFTDNALine)
+	build, err := DetectBuild(records)
+	if err != nil {
+		return ParseResult{Err: err}
+	}
+	if build == "" {
+		build = defaultBuild
+	}
+
+	return ParseResult{
+		Data: DNAData{
+			Records: records,
+			Format:  "ftdna",
+			Build:   build,
+			Version: version,
+		},
+	}
+}
+
+func parseFTDNALine(line string) (DNARecord, bool, *ParseError) {
+	if strings.HasPrefix(line, "#") || line == "" {
+		return DNARecord{}, false, nil
+	}
+	if strings.ReplaceAll(line, "\"", "") == "RSID,CHROMOSOME,POSITION,RESULT" {
+		return DNARecord{}, false, nil
+	}
+
+	fields := strings.Split(line, ",")
+	for i, field := range fields {
+		fields[i] = strings.Trim(field, "\"")
+	}
+	return genotypeLine(fields)
+}
+
+func newFTDNAWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	return newTextWriter(outFile, "RSID,CHROMOSOME,POSITION,RESULT\n", func(record DNARecord) string {
+		return fmt.Sprintf("%s,%s,%s,%s\n",
+			record.RSID, record.Chromosome.letters(), record.Position, record.genotypeOr("--"))
+	})
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "gen",
+		NewWriter: newGenWriter,
+	})
+}
+
+// genWriter writes an Oxford GEN/SAMPLE pair. Hard calls become genotype
+// probabilities of 0 and 1, and missing calls have all three set to 0.
+type genWriter struct {
+	gen    *outputFile
+	sample *outputFile
+}
+
+func newGenWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	files, err := createOutputs(outputPrefix(outFile, ".gen", ".sample"), ".gen", ".sample")
+	if err != nil {
+		return nil, err
+	}
+	w := &genWriter{gen: files[0], sample: files[1]}
+	writeOxfordSample(w.sample, opts)
+	return w, nil
+}
+
+func (w *genWriter) Write(record DNARecord) error {
+	a1, a2 := callAlleles(record)
+	return w.writeVariant(record, a1, a2)
+}
+
+func (w *genWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	if !template.hasAlleles() {
+		return w.Write(record)
+	}
+	return w.writeVariant(record, template.ReferenceA1, template.ReferenceA2)
+}
+
+func (w *genWriter) writeVariant(record DNARecord, a1, a2 string) error {
+	probabilities := genotypeProbabilities(record, a1, a2)
+	_, err := fmt.Fprintf(w.gen, "%s %s %s %s %s %d %d %d\n",
+		record.Chromosome, record.RSID, record.Position, a1, a2,
+		probabilities[0], probabilities[1], probabilities[2])
+	if err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *genWriter) Close() error {
+	return closeOutputs([]*outputFile{w.gen, w.sample})
+}
+
+// genotypeProbabilities returns the probabilities of the a1/a1, a1/a2 and
+// a2/a2 genotypes for a hard call.
+func genotypeProbabilities(record DNARecord, a1, a2 string) [3]int {
+	switch bedGenotype(record, a1, a2) {
+		case bedHomA1:
+			return [3]int{1, 0, 0}
+		case bedHet:
+			return [3]int{0, 1, 0}
+		case bedHomA2:
+			return [3]int{0, 0, 1}
+		default:
+			return [3]int{0, 0, 0}
+	}
+}
+
+// writeOxfordSample writes a .sample file with the two ID columns, the
+// missingness column and the sex of the sample.
+func writeOxfordSample(sample *outputFile, opts WriteOptions) {
+	familyID := opts.FamilyID
+	if familyID == "" {
+		familyID = opts.SampleID
+	}
+	fmt.Fprintln(sample, "ID_1 ID_2 missing sex")
+	fmt.Fprintln(sample, "0 0 0 D")
+	fmt.Fprintf(sample, "%s %s 0 %s\n", familyID, opts.SampleID, opts.Sex.oxfordCode())
+}
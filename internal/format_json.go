@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"encoding/json"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "json",
+		NewWriter: newJSONWriter,
+	})
+}
+
+// jsonMetadata is the first line of the output.
+type jsonMetadata struct {
+	Generator  string `json:"generator"`
+	SampleID   string `json:"sampleID"`
+	FamilyID   string `json:"familyID,omitempty"`
+	Sex        string `json:"sex"`
+	Population string `json:"population,omitempty"`
+}
+
+// jsonRecord is one line per record. Missing calls carry no alleles, haploid
+// calls only allele1, and the status is only set by align.
+type jsonRecord struct {
+	RSID       string `json:"rsid"`
+	Chromosome string `json:"chromosome"`
+	Position   int64  `json:"position"`
+	Allele1    string `json:"allele1,omitempty"`
+	Allele2    string `json:"allele2,omitempty"`
+	Ploidy     int    `json:"ploidy,omitempty"`
+	Missing    bool   `json:"missing"`
+	Status     string `json:"status,omitempty"`
+}
+
+// jsonWriter writes newline-delimited JSON: a metadata object, then one
+// object per record.
+type jsonWriter struct {
+	out *outputFile
+}
+
+func newJSONWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	out, err := createOutput(outFile)
+	if err != nil {
+		return nil, err
+	}
+	w := &jsonWriter{out: out}
+
+	metadata := jsonMetadata{
+		Generator:  "terraseq",
+		SampleID:   opts.SampleID,
+		FamilyID:   opts.FamilyID,
+		Sex:        opts.Sex.String(),
+		Population: opts.Population,
+	}
+	if err := w.writeLine(metadata); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *jsonWriter) Write(record DNARecord) error {
+	position, err := strconv.ParseInt(record.Position, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid position %q for %s", record.Position, record.RSID)
+	}
+
+	line := jsonRecord{
+		RSID:       record.RSID,
+		Chromosome: record.Chromosome.String(),
+		Position:   position,
+		Ploidy:     record.Ploidy,
+		Missing:    record.NoCall(),
+		Status:     record.Status,
+	}
+	if !line.Missing {
+		line.Allele1, line.Allele2 = record.Allele1, record.Allele2
+		if record.haploid() {
+			line.Allele2 = ""
+		}
+	}
+	return w.writeLine(line)
+}
+
+func (w *jsonWriter) writeLine(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding record: %v", err)
+	}
+	b = append(b, '\n')
+	if _, err := w.out.Write(b); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	return w.out.Close()
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// Header written by LivingDNA exports. Their upload checks look for the
+// banner and the column header, so both are reproduced as is, with the build
+// of the kit in place of %s.
+const livingDNAHeader = `# Living DNA customer genotype data download file version: 1.0.1
+# Genotypes are presented on the forward strand of the Human Genome Reference %s.
+# Missing genotypes are shown as --
+# rsid	chromosome	position	genotype
+`
+
+// Names of the builds in the header. LivingDNA exports are on build 37,
+// which is also assumed when the build of the kit is unknown.
+var livingDNABuilds = map[string]string{
+	"":   "Build 37 (GRCh37)",
+	"36": "Build 36 (NCBI36)",
+	"37": "Build 37 (GRCh37)",
+	"38": "Build 38 (GRCh38)",
+}
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "livingdna",
+		Parse:     ParseLivingDNA,
+		NewWriter: newLivingDNAWriter,
+		Detect:    detectLivingDNA,
+	})
+}
+
+func detectLivingDNA(head []string) float64 {
+	return 0.25*dataFraction(head, tabFields(4, isGenotype)) +
+		0.5*boolScore(hasBanner(head, "Living DNA") || hasBanner(head, "LivingDNA")) +
+		0.25*boolScore(hasHeader(head, "rsid\tchromosome\tposition\tgenotype"))
+}
+
+// ParseLivingDNA reads a LivingDNA export. Its lines have the same layout as
+// a 23andMe file, with -- for no-calls.
+func ParseLivingDNA(filename string, opts ParseOptions) ParseResult {
+	return ParseResult{
+		Data: DNAData{
+			Records: scanRecords(filename, opts, parse23andMeLine),
+			Format:  "livingdna",
+		},
+	}
+}
+
+func newLivingDNAWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	build, ok := livingDNABuilds[opts.Build]
+	if !ok {
+		return nil, fmt.Errorf("unsupported build for livingdna output: %s (options: 36, 37, 38)", opts.Build)
+	}
+	return newTextWriter(outFile, fmt.Sprintf(livingDNAHeader, build), func(record DNARecord) string {
+		return fmt.Sprintf("%s\t%s\t%s\t%s\n",
+			record.RSID, record.Chromosome.letters(), record.Position, record.haploidGenotypeOr("--"))
+	})
+}
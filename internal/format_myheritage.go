@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "myheritage",
+		Parse:     ParseMyHeritage,
+		NewWriter: newQuotedCSVWriter,
+		Detect:    detectMyHeritage,
+	})
+}
+
+func detectMyHeritage(head []string) float64 {
+	return 0.25*dataFraction(head, csvFields(4, true)) +
+		0.5*boolScore(hasBanner(head, "MyHeritage")) +
+		0.25*boolScore(hasHeader(head, "RSID,CHROMOSOME,POSITION,RESULT"))
+}
+
+func ParseMyHeritage(filename string, opts ParseOptions) ParseResult {
+	return ParseResult{
+		Data: DNAData{
+			Records: scanRecords(filename, opts, parseMyHeritageLine),
+			Format:  "myheritage",
+		},
+	}
+}
+
+func parseMyHeritageLine(line string) (DNARecord, bool, *ParseError) {
+	if strings.HasPrefix(line, "#") || line == "" {
+		return DNARecord{}, false, nil
+	}
+	if line == "RSID,CHROMOSOME,POSITION,RESULT" {
+		return DNARecord{}, false, nil
+	}
+
+	fields := strings.Split(line, ",")
+	for i, field := range fields {
+		fields[i] = strings.Trim(field, "\"")
+	}
+	return genotypeLine(fields)
+}
+
+// newQuotedCSVWriter writes the quoted CSV layout shared by MyHeritage and
+// FTDNA v1 files.
+func newQuotedCSVWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	return newTextWriter(outFile, "RSID,CHROMOSOME,POSITION,RESULT\n", func(record DNARecord) string {
+		return fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\"\n",
+			record.RSID, record.Chromosome.letters(), record.Position, record.genotypeOr("--"))
+	})
+}
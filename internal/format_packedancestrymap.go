@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Length of the header and of every SNP record in a packed .geno file. It is
+// ceil(individuals/4) bytes with a minimum of 48, so always 48 for one sample.
+const packedRecordLength = 48
+
+// Two-bit code of a missing genotype in a packed .geno file
+const packedMissing = 3
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "packedancestrymap",
+		Parse:     ParseEigenstrat,
+		NewWriter: newPackedAncestryMapWriter,
+		Detect:    detectPackedAncestryMap,
+	})
+}
+
+func detectPackedAncestryMap(head []string) float64 {
+	if len(head) > 0 && strings.HasPrefix(head[0], "GENO ") {
+		return 1
+	}
+	return 0
+}
+
+// packedAncestryMapWriter writes a single-sample PACKEDANCESTRYMAP dataset.
+// The header holds the SNP count and a hash of the SNP IDs, so a blank header
+// record is written first and filled in on Close.
+type packedAncestryMapWriter struct {
+	geno  *outputFile
+	snp   *outputFile
+	ind   *outputFile
+	snps  int
+	shash int32
+	ihash int32
+}
+
+func newPackedAncestryMapWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	files, err := createOutputs(outputPrefix(outFile, ".geno", ".snp", ".ind"), ".geno", ".snp", ".ind")
+	if err != nil {
+		return nil, err
+	}
+	w := &packedAncestryMapWriter{geno: files[0], snp: files[1], ind: files[2]}
+
+	w.geno.Write(make([]byte, packedRecordLength))
+	writeIndLine(w.ind, opts)
+	w.ihash = hashArray([]string{opts.SampleID})
+	return w, nil
+}
+
+func (w *packedAncestryMapWriter) Write(record DNARecord) error {
+	ref, alt := eigenstratAlleles(record)
+	return w.writeSNP(record, 0, ref, alt)
+}
+
+func (w *packedAncestryMapWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	if !template.hasAlleles() {
+		ref, alt := eigenstratAlleles(record)
+		return w.writeSNP(record, template.Value, ref, alt)
+	}
+	return w.writeSNP(record, template.Value, template.ReferenceA1, template.ReferenceA2)
+}
+
+func (w *packedAncestryMapWriter) writeSNP(record DNARecord, cM float64, ref, alt string) error {
+	writeSnpLine(w.snp, record, cM, ref, alt)
+	w.snps++
+	w.shash = w.shash*17 ^ hashString(record.RSID)
+
+	genotype := eigenstratGenotype(record, ref, alt)
+	if genotype == eigenstratMissing {
+		genotype = packedMissing
+	}
+	// The first individual sits in the two high bits of the first byte
+	buf := make([]byte, packedRecordLength)
+	buf[0] = byte(genotype << 6)
+	if _, err := w.geno.Write(buf); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *packedAncestryMapWriter) Close() error {
+	if err := w.geno.Flush(); err != nil {
+		closeOutputs([]*outputFile{w.geno, w.snp, w.ind})
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+
+	header := make([]byte, packedRecordLength)
+	copy(header, fmt.Sprintf("GENO %7d %7d %x %x", 1, w.snps, uint32(w.ihash), uint32(w.shash)))
+	if _, err := w.geno.file.WriteAt(header, 0); err != nil {
+		closeOutputs([]*outputFile{w.geno, w.snp, w.ind})
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return closeOutputs([]*outputFile{w.geno, w.snp, w.ind})
+}
+
+// hashString and hashArray are the hashit and hasharr functions of
+// EIGENSOFT, which check that a .geno matches its .snp and .ind files. They
+// rely on 32-bit integer overflow.
+func hashString(s string) int32 {
+	var hash int32
+	for i := 0; i < len(s); i++ {
+		hash = hash*23 + int32(int8(s[i]))
+	}
+	return hash
+}
+
+func hashArray(names []string) int32 {
+	var hash int32
+	for _, name := range names {
+		hash = hash*17 ^ hashString(name)
+	}
+	return hash
+}
@@ -0,0 +1,18 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestPackedAncestryMapWriter(t *testing.T) {
+	prefix := writeTestRecords(t, "packedancestrymap")
+
+	// Header record with the individual and SNP counts and the EIGENSOFT
+	// hashes of "s1" and of rs1, rs2 and rs3, then one record per SNP
+	want := make([]byte, 4*packedRecordLength)
+	copy(want, "GENO       1       3 a86 11a4f8b")
+	want[1*packedRecordLength] = 0x40 // rs1: one copy of A
+	want[2*packedRecordLength] = 0x80 // rs2: two copies of A
+	want[3*packedRecordLength] = 0xc0 // rs3: missing
+	checkFile(t, prefix+".geno", want)
+}
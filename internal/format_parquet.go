@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Rows buffered before they are handed to the parquet writer
+const parquetBatchSize = 4096
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "parquet",
+		NewWriter: newParquetWriter,
+	})
+}
+
+// parquetRow is one row of the output. Every row names its sample, so the
+// files of several kits can be queried together. Missing calls have null
+// alleles, haploid calls a null allele2, and the status is null outside of
+// align.
+type parquetRow struct {
+	Sample     string `parquet:"sample,dict"`
+	RSID       string `parquet:"rsid"`
+	Chromosome string `parquet:"chromosome,dict"`
+	Position   int64  `parquet:"position"`
+	Allele1    string `parquet:"allele1,optional,dict"`
+	Allele2    string `parquet:"allele2,optional,dict"`
+	Status     string `parquet:"status,optional,dict"`
+}
+
+// parquetWriter writes an Apache Parquet file, compressed with Snappy.
+type parquetWriter struct {
+	out      *outputFile
+	writer   *parquet.GenericWriter[parquetRow]
+	rows     []parquetRow
+	sampleID string
+}
+
+func newParquetWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	out, err := createOutput(outFile)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetWriter{
+		out:      out,
+		writer:   parquet.NewGenericWriter[parquetRow](out, parquet.Compression(&parquet.Snappy)),
+		rows:     make([]parquetRow, 0, parquetBatchSize),
+		sampleID: opts.SampleID,
+	}, nil
+}
+
+func (w *parquetWriter) Write(record DNARecord) error {
+	position, err := strconv.ParseInt(record.Position, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid position %q for %s", record.Position, record.RSID)
+	}
+
+	row := parquetRow{
+		Sample:     w.sampleID,
+		RSID:       record.RSID,
+		Chromosome: record.Chromosome.String(),
+		Position:   position,
+		Status:     record.Status,
+	}
+	if !record.NoCall() {
+		row.Allele1, row.Allele2 = record.Allele1, record.Allele2
+		if record.haploid() {
+			row.Allele2 = ""
+		}
+	}
+	w.rows = append(w.rows, row)
+	if len(w.rows) == parquetBatchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *parquetWriter) flush() error {
+	if _, err := w.writer.Write(w.rows); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	w.rows = w.rows[:0]
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.flush(); err != nil {
+		w.out.Close()
+		return err
+	}
+	if err := w.writer.Close(); err != nil {
+		w.out.Close()
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return w.out.Close()
+}
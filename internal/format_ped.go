@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "ped",
+		NewWriter: newPedWriter,
+	})
+}
+
+// pedWriter writes a PLINK text PED/MAP pair. The single .ped line grows by
+// one allele pair per variant and is ended on Close.
+type pedWriter struct {
+	ped     *outputFile
+	mapFile *outputFile
+}
+
+func newPedWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	files, err := createOutputs(outputPrefix(outFile, ".ped", ".map"), ".ped", ".map")
+	if err != nil {
+		return nil, err
+	}
+	w := &pedWriter{ped: files[0], mapFile: files[1]}
+	w.ped.WriteString(famFields(opts))
+	return w, nil
+}
+
+func (w *pedWriter) Write(record DNARecord) error {
+	return w.writeVariant(record, 0)
+}
+
+func (w *pedWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	return w.writeVariant(record, template.Value)
+}
+
+func (w *pedWriter) writeVariant(record DNARecord, cM float64) error {
+	allele1, allele2 := plinkAlleles(record)
+	fmt.Fprintf(w.mapFile, "%s\t%s\t%s\t%s\n", record.Chromosome.numeric(), record.RSID, formatGeneticPosition(cM), record.Position)
+	if _, err := fmt.Fprintf(w.ped, " %s %s", allele1, allele2); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *pedWriter) Close() error {
+	w.ped.WriteString("\n")
+	return closeOutputs([]*outputFile{w.ped, w.mapFile})
+}
+
+// plinkAlleles returns the alleles of a call for PLINK text formats, which
+// write missing genotypes as 0 0.
+func plinkAlleles(record DNARecord) (string, string) {
+	if record.NoCall() {
+		return "0", "0"
+	}
+	return record.Allele1, record.Allele2
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"bytes"
+	"encoding/binary"
+)
+
+// Magic bytes of a fixed-width, hardcall-only PLINK 2 .pgen file
+var pgenMagic = []byte{0x6c, 0x1b, 0x02}
+
+// Two-bit .pgen code of a missing call; calls are coded as the copies of ALT
+const pgenMissing = 0x3
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "pgen",
+		NewWriter: newPgenWriter,
+	})
+}
+
+// pgenWriter writes a single-sample PLINK 2 .pgen/.pvar/.psam dataset. The
+// .pgen header holds the variant count, so it is written again on Close.
+type pgenWriter struct {
+	pgen     *outputFile
+	pvar     *outputFile
+	psam     *outputFile
+	variants uint32
+}
+
+func newPgenWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	files, err := createOutputs(outputPrefix(outFile, ".pgen", ".pvar", ".psam"), ".pgen", ".pvar", ".psam")
+	if err != nil {
+		return nil, err
+	}
+	w := &pgenWriter{pgen: files[0], pvar: files[1], psam: files[2]}
+
+	w.pgen.Write(w.header())
+	fmt.Fprintln(w.pvar, "#CHROM\tPOS\tID\tREF\tALT\tCM")
+	writePsam(w.psam, opts)
+	return w, nil
+}
+
+// header returns the magic bytes, the variant and sample counts and the
+// header control byte.
+func (w *pgenWriter) header() []byte {
+	var b bytes.Buffer
+	b.Write(pgenMagic)
+	binary.Write(&b, binary.LittleEndian, w.variants)
+	binary.Write(&b, binary.LittleEndian, uint32(1))
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+// writePsam writes the .psam of the sample, with the sex coded 1, 2 or NA.
+func writePsam(psam *outputFile, opts WriteOptions) {
+	familyID := opts.FamilyID
+	if familyID == "" {
+		familyID = opts.SampleID
+	}
+	fmt.Fprintln(psam, "#FID\tIID\tSEX")
+	fmt.Fprintf(psam, "%s\t%s\t%s\n", familyID, opts.SampleID, opts.Sex.oxfordCode())
+}
+
+// Write is used by convert. As when plink2 imports a .bed, the second allele
+// of the call is taken as REF.
+func (w *pgenWriter) Write(record DNARecord) error {
+	a1, a2 := callAlleles(record)
+	return w.writeVariant(record, 0, a2, a1)
+}
+
+// WriteTemplate takes REF and ALT from the first and second allele of the
+// template, as the vcf and eigenstrat outputs do.
+func (w *pgenWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	if !template.hasAlleles() {
+		a1, a2 := callAlleles(record)
+		return w.writeVariant(record, template.Value, a2, a1)
+	}
+	return w.writeVariant(record, template.Value, template.ReferenceA1, template.ReferenceA2)
+}
+
+func (w *pgenWriter) writeVariant(record DNARecord, cM float64, ref, alt string) error {
+	fmt.Fprintf(w.pvar, "%s\t%s\t%s\t%s\t%s\t%s\n",
+		record.Chromosome, record.Position, record.RSID, pvarAllele(ref), pvarAllele(alt), formatGeneticPosition(cM))
+	if err := w.pgen.WriteByte(pgenGenotype(record, ref, alt)); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	w.variants++
+	return nil
+}
+
+// pvarAllele writes an unknown allele as "." rather than PLINK 1's "0".
+func pvarAllele(allele string) string {
+	if isMissingAllele(allele) {
+		return "."
+	}
+	return allele
+}
+
+// pgenGenotype counts the copies of the ALT allele. Calls with an allele that
+// is neither REF nor ALT are written as missing.
+func pgenGenotype(record DNARecord, ref, alt string) byte {
+	if record.NoCall() {
+		return pgenMissing
+	}
+	var count byte
+	for _, allele := range []string{record.Allele1, record.Allele2} {
+		switch allele {
+			case ref:
+			case alt:
+				count++
+			default:
+				return pgenMissing
+		}
+	}
+	return count
+}
+
+func (w *pgenWriter) Close() error {
+	if err := w.pgen.Flush(); err != nil {
+		closeOutputs([]*outputFile{w.pgen, w.pvar, w.psam})
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	if _, err := w.pgen.file.WriteAt(w.header(), 0); err != nil {
+		closeOutputs([]*outputFile{w.pgen, w.pvar, w.psam})
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return closeOutputs([]*outputFile{w.pgen, w.pvar, w.psam})
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestPgenWriter(t *testing.T) {
+	prefix := writeTestRecords(t, "pgen")
+
+	checkFile(t, prefix+".pgen", []byte{
+		0x6c, 0x1b, 0x02, // magic
+		0x03, 0x00, 0x00, 0x00, // variants
+		0x01, 0x00, 0x00, 0x00, // samples
+		0x00, // control byte
+		0x01, // rs1: REF G, ALT A, one copy of ALT
+		0x00, // rs2: REF A, no ALT allele
+		0x03, // rs3: missing
+	})
+	checkFile(t, prefix+".pvar", []byte("#CHROM\tPOS\tID\tREF\tALT\tCM\n"+
+		"1\t100\trs1\tG\tA\t0\n"+
+		"X\t200\trs2\tA\t.\t0\n"+
+		"1\t300\trs3\t.\t.\t0\n"))
+	checkFile(t, prefix+".psam", []byte("#FID\tIID\tSEX\ns1\ts1\t1\n"))
+}
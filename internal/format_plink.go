@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"math"
+	"bufio"
+	"bytes"
+	"strings"
+	"strconv"
+)
+
+// Magic bytes of a SNP-major PLINK .bed file
+var bedMagic = []byte{0x6c, 0x1b, 0x01}
+
+// Two-bit genotype codes of a .bed file, relative to the .bim alleles
+const (
+	bedHomA1   = 0x0
+	bedMissing = 0x1
+	bedHet     = 0x2
+	bedHomA2   = 0x3
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "plink",
+		Parse:     ParsePLINK,
+		NewWriter: newPlinkWriter,
+		Detect:    detectPLINK,
+	})
+}
+
+func detectPLINK(head []string) float64 {
+	if len(head) > 0 && strings.HasPrefix(head[0], string(bedMagic)) {
+		return 1
+	}
+	return 0
+}
+
+// ParsePLINK reads one sample of a binary PLINK dataset. The filename may
+// be the .bed, .bim or .fam file or their common prefix, and opts.Sample is
+// matched against the individual ID, or "FID IID", of the .fam file.
+func ParsePLINK(filename string, opts ParseOptions) ParseResult {
+	prefix := outputPrefix(filename, ".bed", ".bim", ".fam")
+	index, samples, err := famSampleIndex(prefix+".fam", opts)
+	if err != nil {
+		return ParseResult{Err: err}
+	}
+	if err := checkBedHeader(prefix + ".bed"); err != nil {
+		return ParseResult{Err: err}
+	}
+
+	return ParseResult{
+		Data: DNAData{
+			Records: bedRecords(prefix, index, samples, opts),
+			Format:  "plink",
+		},
+	}
+}
+
+// famSampleIndex returns the position of the sample in the .fam file and the
+// number of samples. Without a sample name the dataset must hold one sample.
+// A malformed line still stands for a sample of the .bed.
+func famSampleIndex(famFile string, opts ParseOptions) (int, int, error) {
+	sample := opts.Sample
+	file, err := OpenInput(famFile)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	index := -1
+	var samples int
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if problem := fieldCountProblem(fields, 6); problem != nil {
+			problem.File, problem.Line = famFile, lineNumber
+			if err := reportProblem(*problem, opts); err != nil {
+				return 0, 0, err
+			}
+		}
+		if index < 0 && len(fields) > 1 && (fields[1] == sample || fields[0]+" "+fields[1] == sample) {
+			index = samples
+		}
+		samples++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error reading file: %v", err)
+	}
+
+	switch {
+		case sample == "" && samples == 1:
+			return 0, 1, nil
+		case sample == "":
+			return 0, 0, fmt.Errorf("PLINK dataset has %d samples, choose one with --sample", samples)
+		case index < 0:
+			return 0, 0, fmt.Errorf("sample %s not found in %s", sample, famFile)
+	}
+	return index, samples, nil
+}
+
+func checkBedHeader(bedFile string) error {
+	file, err := os.Open(bedFile)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(bedMagic))
+	if _, err := io.ReadFull(file, magic); err != nil || !bytes.Equal(magic, bedMagic) {
+		return fmt.Errorf("%s is not a SNP-major PLINK .bed file", bedFile)
+	}
+	return nil
+}
+
+// bedRecords walks the .bim and the .bed side by side. Every variant takes
+// ceil(samples/4) bytes of the .bed, with the first sample in the low bits.
+func bedRecords(prefix string, index int, samples int, opts ParseOptions) func(yield func(DNARecord, error) bool) {
+	return func(yield func(DNARecord, error) bool) {
+		bim, err := OpenInput(prefix + ".bim")
+		if err != nil {
+			yield(DNARecord{}, fmt.Errorf("error opening file: %v", err))
+			return
+		}
+		defer bim.Close()
+		bedFile, err := os.Open(prefix + ".bed")
+		if err != nil {
+			yield(DNARecord{}, fmt.Errorf("error opening file: %v", err))
+			return
+		}
+		defer bedFile.Close()
+
+		bed := bufio.NewReader(bedFile)
+		if _, err := bed.Discard(len(bedMagic)); err != nil {
+			yield(DNARecord{}, fmt.Errorf("error reading file: %v", err))
+			return
+		}
+		block := make([]byte, (samples+3)/4)
+
+		scanner := bufio.NewScanner(bim)
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			if _, err := io.ReadFull(bed, block); err != nil {
+				yield(DNARecord{}, fmt.Errorf("%s.bed is shorter than %s.bim: %v", prefix, prefix, err))
+				return
+			}
+			// A malformed variant still has its block in the .bed, read above
+			if problem := fieldCountProblem(fields, 6); problem != nil {
+				problem.File, problem.Line = prefix+".bim", lineNumber
+				if !handleProblem(*problem, opts, yield) {
+					return
+				}
+				continue
+			}
+
+			a1, a2 := fields[4], fields[5]
+			var allele1, allele2 string
+			switch (block[index/4] >> (2 * (index % 4))) & 0x3 {
+				case bedHomA1:
+					allele1, allele2 = a1, a1
+				case bedHet:
+					allele1, allele2 = a1, a2
+				case bedHomA2:
+					allele1, allele2 = a2, a2
+				default:
+					allele1, allele2 = "-", "-"
+			}
+
+			record := DNARecord{
+				RSID:        fields[1],
+				Chromosome:  ParseChromosome(fields[0]),
+				Position:    fields[3],
+				Allele1:     allele1,
+				Allele2:     allele2,
+				RawGenotype: allele1 + allele2,
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(DNARecord{}, fmt.Errorf("error reading file: %v", err))
+		}
+	}
+}
+
+// plinkWriter writes a single-sample binary PLINK dataset. With one sample
+// every variant takes one byte of the .bed.
+type plinkWriter struct {
+	bed *outputFile
+	bim *outputFile
+	fam *outputFile
+}
+
+func newPlinkWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	files, err := createOutputs(outputPrefix(outFile, ".bed", ".bim", ".fam"), ".bed", ".bim", ".fam")
+	if err != nil {
+		return nil, err
+	}
+	w := &plinkWriter{bed: files[0], bim: files[1], fam: files[2]}
+
+	w.bed.Write(bedMagic)
+	fmt.Fprintln(w.fam, famFields(opts))
+	return w, nil
+}
+
+// famFields returns the leading columns of a .fam, .tfam or .ped line: family
+// ID, individual ID, father, mother, sex and phenotype.
+func famFields(opts WriteOptions) string {
+	familyID := opts.FamilyID
+	if familyID == "" {
+		familyID = opts.SampleID
+	}
+	return fmt.Sprintf("%s %s 0 0 %s -9", familyID, opts.SampleID, opts.Sex.plinkCode())
+}
+
+// Write is used by convert. Without a template the .bim alleles come from
+// the call itself, with 0 for the allele of a monomorphic site.
+func (w *plinkWriter) Write(record DNARecord) error {
+	a1, a2 := callAlleles(record)
+	return w.writeVariant(record, 0, a1, a2)
+}
+
+// callAlleles derives the two alleles of a variant from a call when there is
+// no template, using 0 for unknown alleles as PLINK does.
+func callAlleles(record DNARecord) (string, string) {
+	if record.NoCall() {
+		return "0", "0"
+	}
+	if record.Allele1 == record.Allele2 {
+		return "0", record.Allele2
+	}
+	return record.Allele1, record.Allele2
+}
+
+// WriteTemplate keeps the genetic position and allele columns of the template.
+// Templates without alleles fall back to the alleles of the call.
+func (w *plinkWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	a1, a2 := template.ReferenceA1, template.ReferenceA2
+	if !template.hasAlleles() {
+		a1, a2 = callAlleles(record)
+	}
+	return w.writeVariant(record, template.Value, a1, a2)
+}
+
+func (w *plinkWriter) writeVariant(record DNARecord, cM float64, a1, a2 string) error {
+	fmt.Fprintf(w.bim, "%s\t%s\t%s\t%s\t%s\t%s\n",
+		record.Chromosome.numeric(), record.RSID, formatGeneticPosition(cM), record.Position, a1, a2)
+	if err := w.bed.WriteByte(bedGenotype(record, a1, a2)); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+// bedGenotype codes a call against the .bim alleles. Calls with an allele
+// that is neither are written as missing.
+func bedGenotype(record DNARecord, a1, a2 string) byte {
+	if record.NoCall() {
+		return bedMissing
+	}
+	switch {
+		case record.Allele1 == a1 && record.Allele2 == a1:
+			return bedHomA1
+		case record.Allele1 == a2 && record.Allele2 == a2:
+			return bedHomA2
+		case (record.Allele1 == a1 && record.Allele2 == a2) || (record.Allele1 == a2 && record.Allele2 == a1):
+			return bedHet
+		default:
+			return bedMissing
+	}
+}
+
+func (w *plinkWriter) Close() error {
+	return closeOutputs([]*outputFile{w.bed, w.bim, w.fam})
+}
+
+// formatGeneticPosition renders a cM value the way .bim and .snp files hold
+// it, with 0 for an unknown position.
+func formatGeneticPosition(cM float64) string {
+	if math.IsNaN(cM) {
+		return "0"
+	}
+	return strconv.FormatFloat(cM, 'f', -1, 64)
+}
@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"os"
+	"fmt"
+	"strings"
+	"database/sql"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS samples (
+	id          INTEGER PRIMARY KEY,
+	sample_id   TEXT NOT NULL UNIQUE,
+	family_id   TEXT,
+	sex         TEXT,
+	population  TEXT,
+	format      TEXT,
+	build       TEXT,
+	source_file TEXT
+);
+CREATE TABLE IF NOT EXISTS genotypes (
+	sample     INTEGER NOT NULL REFERENCES samples(id),
+	rsid       TEXT NOT NULL,
+	chromosome TEXT NOT NULL,
+	position   INTEGER NOT NULL,
+	allele1    TEXT,
+	allele2    TEXT,
+	status     TEXT
+);
+CREATE INDEX IF NOT EXISTS genotypes_rsid ON genotypes (rsid);
+CREATE INDEX IF NOT EXISTS genotypes_site ON genotypes (chromosome, position);
+CREATE INDEX IF NOT EXISTS genotypes_sample ON genotypes (sample);
+`
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "sqlite",
+		Parse:     ParseSQLite,
+		NewWriter: newSQLiteWriter,
+		Detect:    detectSQLite,
+	})
+}
+
+func detectSQLite(head []string) float64 {
+	if len(head) > 0 && strings.HasPrefix(head[0], "SQLite format 3") {
+		return 1
+	}
+	return 0
+}
+
+// ParseSQLite reads one kit back out of a database written by the sqlite
+// output. opts.Sample is the sample ID, and may be left out when the
+// database holds a single kit.
+func ParseSQLite(filename string, opts ParseOptions) ParseResult {
+	// Opening a missing path would create an empty database there
+	if _, err := os.Stat(filename); err != nil {
+		return ParseResult{Err: fmt.Errorf("error opening file: %v", err)}
+	}
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return ParseResult{Err: fmt.Errorf("error opening file: %v", err)}
+	}
+	defer db.Close()
+
+	var id int64
+	var format, build string
+	query := "SELECT id, COALESCE(format, ''), COALESCE(build, '') FROM samples WHERE sample_id = ?"
+	args := []any{opts.Sample}
+	if opts.Sample == "" {
+		var samples int
+		if err := db.QueryRow("SELECT COUNT(*) FROM samples").Scan(&samples); err != nil {
+			return ParseResult{Err: fmt.Errorf("error reading %s: %v", filename, err)}
+		}
+		if samples != 1 {
+			return ParseResult{Err: fmt.Errorf("database has %d samples, choose one with --sample", samples)}
+		}
+		query, args = "SELECT id, COALESCE(format, ''), COALESCE(build, '') FROM samples", nil
+	}
+	switch err := db.QueryRow(query, args...).Scan(&id, &format, &build); {
+		case err == sql.ErrNoRows:
+			return ParseResult{Err: fmt.Errorf("sample %s not found in %s", opts.Sample, filename)}
+		case err != nil:
+			return ParseResult{Err: fmt.Errorf("error reading %s: %v", filename, err)}
+	}
+
+	return ParseResult{
+		Data: DNAData{
+			Records: sqliteRecords(filename, id),
+			Format:  format,
+			Build:   build,
+		},
+	}
+}
+
+// sqliteRecords streams the genotypes of a sample in the order they were
+// written.
+func sqliteRecords(filename string, sample int64) func(yield func(DNARecord, error) bool) {
+	return func(yield func(DNARecord, error) bool) {
+		db, err := sql.Open("sqlite", filename)
+		if err != nil {
+			yield(DNARecord{}, fmt.Errorf("error opening file: %v", err))
+			return
+		}
+		defer db.Close()
+
+		rows, err := db.Query(`SELECT rsid, chromosome, position, allele1, allele2
+			FROM genotypes WHERE sample = ? ORDER BY rowid`, sample)
+		if err != nil {
+			yield(DNARecord{}, fmt.Errorf("error reading %s: %v", filename, err))
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var record DNARecord
+			var chromosome string
+			var allele1, allele2 sql.NullString
+			if err := rows.Scan(&record.RSID, &chromosome, &record.Position, &allele1, &allele2); err != nil {
+				yield(DNARecord{}, fmt.Errorf("error reading %s: %v", filename, err))
+				return
+			}
+			record.Chromosome = ParseChromosome(chromosome)
+			// A haploid call has no second allele
+			switch {
+				case !allele1.Valid:
+					record.Allele1, record.Allele2, record.Ploidy = "-", "-", 2
+				case !allele2.Valid:
+					record.Allele1, record.Allele2, record.Ploidy = allele1.String, allele1.String, 1
+				default:
+					record.Allele1, record.Allele2, record.Ploidy = allele1.String, allele2.String, 2
+			}
+			record.RawGenotype = record.Allele1 + record.Allele2
+			if !yield(record, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(DNARecord{}, fmt.Errorf("error reading %s: %v", filename, err))
+		}
+	}
+}
+
+// sqliteWriter adds a kit to a database, creating the tables the first time.
+// The kit is written in one transaction, committed on Close and rolled back
+// on Abort, so a failed run leaves the database as it was.
+type sqliteWriter struct {
+	db     *sql.DB
+	tx     *sql.Tx
+	insert *sql.Stmt
+	sample int64
+}
+
+func newSQLiteWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	db, err := sql.Open("sqlite", outFile)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+	w := &sqliteWriter{db: db}
+	if err := w.begin(opts); err != nil {
+		if w.tx != nil {
+			w.tx.Rollback()
+		}
+		db.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *sqliteWriter) begin(opts WriteOptions) error {
+	if _, err := w.db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("error creating tables: %v", err)
+	}
+
+	var exists bool
+	if err := w.db.QueryRow("SELECT EXISTS (SELECT 1 FROM samples WHERE sample_id = ?)", opts.SampleID).Scan(&exists); err != nil {
+		return fmt.Errorf("error reading output file: %v", err)
+	}
+	if exists {
+		return fmt.Errorf("sample %s is already in the database, choose another name with --sampleID", opts.SampleID)
+	}
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	w.tx = tx
+	result, err := tx.Exec(`INSERT INTO samples (sample_id, family_id, sex, population, format, build, source_file)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		opts.SampleID, opts.FamilyID, opts.Sex.String(), opts.Population, opts.SourceFormat, opts.Build, opts.SourceFile)
+	if err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	if w.sample, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	w.insert, err = tx.Prepare(`INSERT INTO genotypes (sample, rsid, chromosome, position, allele1, allele2, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *sqliteWriter) Write(record DNARecord) error {
+	var allele1, allele2, status any
+	if !record.NoCall() {
+		allele1, allele2 = record.Allele1, record.Allele2
+		if record.haploid() {
+			allele2 = nil
+		}
+	}
+	if record.Status != "" {
+		status = record.Status
+	}
+	if _, err := w.insert.Exec(w.sample, record.RSID, record.Chromosome.String(), record.Position, allele1, allele2, status); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *sqliteWriter) Close() error {
+	defer w.db.Close()
+	w.insert.Close()
+	if err := w.tx.Commit(); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *sqliteWriter) Abort() error {
+	defer w.db.Close()
+	w.insert.Close()
+	if err := w.tx.Rollback(); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"os"
+	"bytes"
+	"testing"
+	"path/filepath"
+)
+
+// testRecords are the calls written by the encoder tests: a heterozygous
+// SNP, a haploid call on X and a no-call.
+var testRecords = []DNARecord{
+	{RSID: "rs1", Chromosome: "1", Position: "100", Allele1: "A", Allele2: "G", Ploidy: 2},
+	{RSID: "rs2", Chromosome: ChrX, Position: "200", Allele1: "A", Allele2: "A", Ploidy: 1},
+	{RSID: "rs3", Chromosome: "1", Position: "300", Allele1: "-", Allele2: "-", Ploidy: 2},
+}
+
+// writeTestRecords writes testRecords for sample s1 in the given output
+// format, and returns the output prefix.
+func writeTestRecords(t *testing.T, format string) string {
+	t.Helper()
+	prefix := filepath.Join(t.TempDir(), "kit")
+	writer, err := NewWriter(prefix, format, WriteOptions{SampleID: "s1", Sex: SexMale})
+	if err != nil {
+		t.Fatalf("creating %s writer: %v", format, err)
+	}
+	for _, record := range testRecords {
+		if err := writer.Write(record); err != nil {
+			t.Fatalf("writing %s: %v", record.RSID, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("closing %s writer: %v", format, err)
+	}
+	return prefix
+}
+
+// checkFile compares a written file with the expected bytes.
+func checkFile(t *testing.T, filename string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("reading %s: %v", filename, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s:\n got % x\nwant % x", filepath.Base(filename), got, want)
+	}
+}
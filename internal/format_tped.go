@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "tped",
+		NewWriter: newTpedWriter,
+	})
+}
+
+// tpedWriter writes a transposed PLINK TPED/TFAM pair, one .tped line per
+// variant.
+type tpedWriter struct {
+	tped *outputFile
+	tfam *outputFile
+}
+
+func newTpedWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	files, err := createOutputs(outputPrefix(outFile, ".tped", ".tfam"), ".tped", ".tfam")
+	if err != nil {
+		return nil, err
+	}
+	w := &tpedWriter{tped: files[0], tfam: files[1]}
+	fmt.Fprintln(w.tfam, famFields(opts))
+	return w, nil
+}
+
+func (w *tpedWriter) Write(record DNARecord) error {
+	return w.writeVariant(record, 0)
+}
+
+func (w *tpedWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	return w.writeVariant(record, template.Value)
+}
+
+func (w *tpedWriter) writeVariant(record DNARecord, cM float64) error {
+	allele1, allele2 := plinkAlleles(record)
+	_, err := fmt.Fprintf(w.tped, "%s %s %s %s %s %s\n",
+		record.Chromosome.numeric(), record.RSID, formatGeneticPosition(cM), record.Position, allele1, allele2)
+	if err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+func (w *tpedWriter) Close() error {
+	return closeOutputs([]*outputFile{w.tped, w.tfam})
+}
@@ -0,0 +1,431 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"bufio"
+	"strings"
+	"strconv"
+	"path/filepath"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:      "vcf",
+		Parse:     ParseVCF,
+		NewWriter: newVCFWriter,
+		Detect:    detectVCF,
+	})
+}
+
+func detectVCF(head []string) float64 {
+	if len(head) > 0 && strings.HasPrefix(head[0], "##fileformat=VCF") {
+		return 1
+	}
+	for _, line := range head {
+		if strings.HasPrefix(line, "#CHROM\tPOS\tID\tREF\tALT") {
+			return 0.8
+		}
+	}
+	return 0
+}
+
+// ParseVCF reads the genotypes of one sample from a VCF 4.x file. GT is
+// decoded against REF and ALT, phased and unphased calls alike. Indels and
+// multi-allelic sites are skipped or kept according to opts. In a gVCF,
+// reference blocks come out as records with End set.
+func ParseVCF(filename string, opts ParseOptions) ParseResult {
+	if opts.Indels == "" {
+		opts.Indels = "skip"
+	}
+	if opts.MultiAllelic == "" {
+		opts.MultiAllelic = "skip"
+	}
+	if opts.Indels != "skip" && opts.Indels != "keep" {
+		return ParseResult{Err: fmt.Errorf("unsupported indel rule: %s (options: skip, keep)", opts.Indels)}
+	}
+	if opts.MultiAllelic != "skip" && opts.MultiAllelic != "keep" {
+		return ParseResult{Err: fmt.Errorf("unsupported multi-allelic rule: %s (options: skip, keep)", opts.MultiAllelic)}
+	}
+
+	sampleColumn, err := vcfSampleColumn(filename, opts.Sample)
+	if err != nil {
+		return ParseResult{Err: err}
+	}
+
+	return ParseResult{
+		Data: DNAData{
+			Records: scanRecords(filename, opts, func(line string) (DNARecord, bool, *ParseError) {
+				return parseVCFLine(line, sampleColumn, opts)
+			}),
+			Format: "vcf",
+		},
+	}
+}
+
+// vcfSampleColumn finds the column of the requested sample in the #CHROM
+// header line. Without a sample name the file must hold a single sample.
+func vcfSampleColumn(filename string, sample string) (int, error) {
+	file, err := OpenInput(filename)
+	if err != nil {
+		return 0, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "##") {
+			continue
+		}
+		if !strings.HasPrefix(line, "#CHROM") {
+			break
+		}
+
+		columns := strings.Split(line, "\t")
+		if len(columns) < 10 {
+			return 0, fmt.Errorf("VCF file has no sample columns")
+		}
+		samples := columns[9:]
+		if sample == "" {
+			if len(samples) == 1 {
+				return 9, nil
+			}
+			return 0, fmt.Errorf("VCF file has %d samples, choose one with --sample", len(samples))
+		}
+		for i, name := range samples {
+			if name == sample {
+				return 9 + i, nil
+			}
+		}
+		return 0, fmt.Errorf("sample %s not found in VCF file", sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("error reading file: %v", err)
+	}
+	return 0, fmt.Errorf("VCF file has no #CHROM header line")
+}
+
+func parseVCFLine(line string, sampleColumn int, opts ParseOptions) (DNARecord, bool, *ParseError) {
+	if strings.HasPrefix(line, "#") || line == "" {
+		return DNARecord{}, false, nil
+	}
+
+	fields := strings.Split(line, "\t")
+	if problem := fieldCountProblem(fields, sampleColumn+1); problem != nil {
+		return DNARecord{}, false, problem
+	}
+	if _, err := strconv.Atoi(fields[1]); err != nil {
+		return DNARecord{}, false, &ParseError{Column: 2, Reason: fmt.Sprintf("invalid position %q", fields[1])}
+	}
+
+	// Allele 0 is REF, the ALT alleles follow in order
+	alleles := []string{strings.ToUpper(fields[3])}
+	var indel bool
+	var alts int
+	for _, alt := range strings.Split(fields[4], ",") {
+		if alt == "." {
+			continue
+		}
+		alt = strings.ToUpper(alt)
+		alleles = append(alleles, alt)
+		if isSymbolicAllele(alt) {
+			continue
+		}
+		alts++
+		if len(alt) != len(alleles[0]) {
+			indel = true
+		}
+	}
+
+	if indel && opts.Indels == "skip" {
+		return DNARecord{}, false, nil
+	}
+	// Multi-base substitutions such as AC>GT are neither SNPs nor indels,
+	// and cannot be coded as D/I
+	if !indel && alts > 0 && len(alleles[0]) != 1 {
+		return DNARecord{}, false, nil
+	}
+	if alts > 1 && opts.MultiAllelic == "skip" {
+		return DNARecord{}, false, nil
+	}
+
+	gt := vcfSampleField(fields[8], fields[sampleColumn], "GT")
+	allele1, allele2 := decodeGT(gt, alleles, indel)
+	record := DNARecord{
+		RSID:        strings.Split(fields[2], ";")[0],
+		Chromosome:  ParseChromosome(fields[0]),
+		Position:    fields[1],
+		Allele1:     allele1,
+		Allele2:     allele2,
+		RawGenotype: allele1 + allele2,
+		Ploidy:      2,
+	}
+	if !strings.ContainsAny(gt, "/|") {
+		record.Ploidy = 1
+	}
+
+	// A gVCF reference block covers POS to END with a homozygous reference
+	// call, and only has symbolic ALT alleles
+	if end := vcfInfoField(fields[7], "END"); end != "" && alts == 0 && isHomRefGT(gt) {
+		if !passesBlockThresholds(fields[8], fields[sampleColumn], opts) {
+			return DNARecord{}, false, nil
+		}
+		record.End = end
+	}
+	return record, true, nil
+}
+
+// vcfInfoField returns the value of key in the INFO column.
+func vcfInfoField(info string, key string) string {
+	for _, entry := range strings.Split(info, ";") {
+		if value, found := strings.CutPrefix(entry, key+"="); found {
+			return value
+		}
+	}
+	return ""
+}
+
+func isHomRefGT(gt string) bool {
+	return gt == "0" || gt == "0/0" || gt == "0|0"
+}
+
+// passesBlockThresholds checks the GQ and DP of a reference block. Blocks
+// report their lowest depth as MIN_DP, falling back to DP. A threshold is
+// failed when its field is absent.
+func passesBlockThresholds(format string, sample string, opts ParseOptions) bool {
+	if opts.MinGQ > 0 {
+		gq, err := strconv.Atoi(vcfSampleField(format, sample, "GQ"))
+		if err != nil || gq < opts.MinGQ {
+			return false
+		}
+	}
+	if opts.MinDP > 0 {
+		value := vcfSampleField(format, sample, "MIN_DP")
+		if value == "" {
+			value = vcfSampleField(format, sample, "DP")
+		}
+		dp, err := strconv.Atoi(value)
+		if err != nil || dp < opts.MinDP {
+			return false
+		}
+	}
+	return true
+}
+
+// vcfSampleField returns the value of key in a sample column, or "" when the
+// FORMAT column does not list it.
+func vcfSampleField(format string, sample string, key string) string {
+	values := strings.Split(sample, ":")
+	for i, name := range strings.Split(format, ":") {
+		if name == key && i < len(values) {
+			return values[i]
+		}
+	}
+	return ""
+}
+
+// decodeGT turns a GT value such as "0/1", "1|1" or "0" into two alleles.
+// Haploid calls are doubled like single-letter vendor genotypes, and missing
+// or symbolic alleles become "-".
+func decodeGT(gt string, alleles []string, indel bool) (string, string) {
+	indexes := strings.FieldsFunc(gt, func(r rune) bool {
+		return r == '/' || r == '|'
+	})
+	if len(indexes) == 0 || len(indexes) > 2 {
+		return "-", "-"
+	}
+
+	decoded := make([]string, len(indexes))
+	for i, index := range indexes {
+		n, err := strconv.Atoi(index)
+		if err != nil || n < 0 || n >= len(alleles) || isSymbolicAllele(alleles[n]) {
+			decoded[i] = "-"
+		} else if indel {
+			decoded[i] = indelAllele(alleles[n], alleles)
+		} else {
+			decoded[i] = alleles[n]
+		}
+	}
+
+	if len(decoded) == 1 {
+		return decoded[0], decoded[0]
+	}
+	// 23andMe writes heterozygous indels as DI
+	if decoded[0] == AlleleInsertion && decoded[1] == AlleleDeletion {
+		return AlleleDeletion, AlleleInsertion
+	}
+	return decoded[0], decoded[1]
+}
+
+// indelAllele codes an allele of an indel site the way 23andMe does: the
+// shortest allele is the deletion D, longer ones are insertions I.
+func indelAllele(allele string, alleles []string) string {
+	shortest := len(allele)
+	for _, other := range alleles {
+		if !isSymbolicAllele(other) && len(other) < shortest {
+			shortest = len(other)
+		}
+	}
+	if len(allele) > shortest {
+		return AlleleInsertion
+	}
+	return AlleleDeletion
+}
+
+// isSymbolicAllele reports ALT values such as <NON_REF>, <DEL>, the spanning
+// deletion * and breakends, which carry no base.
+func isSymbolicAllele(allele string) bool {
+	return strings.HasPrefix(allele, "<") || allele == "*" || strings.ContainsAny(allele, "[]")
+}
+
+// vcfWriter writes a single-sample VCF. The contig lines of the header are
+// only known once every record has been seen, so the body is spooled to a
+// temporary file and copied behind the header on Close.
+type vcfWriter struct {
+	file     *os.File
+	body     *os.File
+	buf      *bufio.Writer
+	sampleID string
+	contigs  []string
+	seen     map[string]bool
+}
+
+func newVCFWriter(outFile string, opts WriteOptions) (RecordWriter, error) {
+	file, err := os.Create(outFile)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+	body, err := os.CreateTemp(filepath.Dir(outFile), ".terraseq-*.vcf")
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error creating temporary file: %v", err)
+	}
+
+	return &vcfWriter{
+		file:     file,
+		body:     body,
+		buf:      bufio.NewWriter(body),
+		sampleID: opts.SampleID,
+		seen:     make(map[string]bool),
+	}, nil
+}
+
+// Write is used by convert, where no reference allele is known. REF is
+// written as N and the called bases as ALT, so that no call is claimed to
+// be homozygous for the reference.
+func (w *vcfWriter) Write(record DNARecord) error {
+	if record.NoCall() || !isBase(record.Allele1) || !isBase(record.Allele2) {
+		return w.writeSite(record, "N", ".")
+	}
+	alt := record.Allele1
+	if record.Allele2 != record.Allele1 {
+		alt += "," + record.Allele2
+	}
+	return w.writeSite(record, "N", alt)
+}
+
+// WriteTemplate takes REF and ALT from the first and second allele of the
+// template, as the eigenstrat output does, unless it has none or codes an
+// indel as D/I, which a VCF cannot hold.
+func (w *vcfWriter) WriteTemplate(template TemplateRecord, record DNARecord) error {
+	if !template.hasAlleles() || isIndelAllele(template.ReferenceA1) || isIndelAllele(template.ReferenceA2) {
+		return w.Write(record)
+	}
+	alt := template.ReferenceA2
+	if isMissingAllele(alt) {
+		alt = "."
+	}
+	return w.writeSite(record, template.ReferenceA1, alt)
+}
+
+func (w *vcfWriter) writeSite(record DNARecord, ref, alt string) error {
+	chromosome := record.Chromosome.letters()
+	if !w.seen[chromosome] {
+		w.seen[chromosome] = true
+		w.contigs = append(w.contigs, chromosome)
+	}
+
+	id := record.RSID
+	if id == "" {
+		id = "."
+	}
+	_, err := fmt.Fprintf(w.buf, "%s\t%s\t%s\t%s\t%s\t.\t.\t.\tGT\t%s\n",
+		chromosome, record.Position, id, ref, alt, encodeGT(record, ref, alt))
+	if err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+// encodeGT encodes a call against REF and ALT. Calls with an allele that is
+// neither, and no-calls, come out as ./., or . for haploid calls.
+func encodeGT(record DNARecord, ref, alt string) string {
+	missing := "./."
+	if record.haploid() {
+		missing = "."
+	}
+	if record.NoCall() {
+		return missing
+	}
+
+	// ALT may list more than one allele, numbered from 1
+	index := func(allele string) string {
+		if allele == ref {
+			return "0"
+		}
+		for i, other := range strings.Split(alt, ",") {
+			if allele == other {
+				return strconv.Itoa(i + 1)
+			}
+		}
+		return ""
+	}
+	index1, index2 := index(record.Allele1), index(record.Allele2)
+	if index1 == "" || index2 == "" {
+		return missing
+	}
+	if record.haploid() {
+		return index1
+	}
+	if index1 > index2 {
+		index1, index2 = index2, index1
+	}
+	return index1 + "/" + index2
+}
+
+func isBase(allele string) bool {
+	return allele == "A" || allele == "C" || allele == "G" || allele == "T"
+}
+
+func (w *vcfWriter) Close() error {
+	defer os.Remove(w.body.Name())
+	defer w.body.Close()
+	defer w.file.Close()
+
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("error writing temporary file: %v", err)
+	}
+
+	header := bufio.NewWriter(w.file)
+	fmt.Fprintln(header, "##fileformat=VCFv4.2")
+	fmt.Fprintln(header, "##source=terraseq")
+	for _, contig := range w.contigs {
+		fmt.Fprintf(header, "##contig=<ID=%s>\n", contig)
+	}
+	fmt.Fprintln(header, "##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">")
+	fmt.Fprintf(header, "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\t%s\n", w.sampleID)
+	if err := header.Flush(); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+
+	if _, err := w.body.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading temporary file: %v", err)
+	}
+	if _, err := io.Copy(w.file, w.body); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"bufio"
+	"bytes"
+	"strings"
+	"archive/zip"
+	"path/filepath"
+	"compress/gzip"
+	"compress/bzip2"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+// Extensions stripped from a filename before looking at its real extension
+var compressionExts = []string{".gz", ".bz2", ".xz", ".zip"}
+
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiCloser) Close() error {
+	var firstErr error
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		if err := m.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// OpenInput opens a file for reading. Compressed files are recognised by
+// their magic bytes and decompressed on the fly, so callers always read text.
+func OpenInput(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(file)
+	magic, _ := buffered.Peek(6)
+
+	switch {
+		case bytes.HasPrefix(magic, gzipMagic):
+			reader, err := gzip.NewReader(buffered)
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("invalid gzip data: %v", err)
+			}
+			return &multiCloser{Reader: reader, closers: []io.Closer{file, reader}}, nil
+		case bytes.HasPrefix(magic, bzip2Magic):
+			return &multiCloser{Reader: bzip2.NewReader(buffered), closers: []io.Closer{file}}, nil
+		case bytes.HasPrefix(magic, xzMagic):
+			reader, err := xz.NewReader(buffered)
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("invalid xz data: %v", err)
+			}
+			return &multiCloser{Reader: reader, closers: []io.Closer{file}}, nil
+		case bytes.HasPrefix(magic, zipMagic):
+			reader, err := openZipMember(file)
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+			return &multiCloser{Reader: reader, closers: []io.Closer{file, reader}}, nil
+		default:
+			return &multiCloser{Reader: buffered, closers: []io.Closer{file}}, nil
+	}
+}
+
+// openZipMember opens the single genotype file inside a vendor archive.
+// Directories, macOS metadata and hidden files are ignored, and when several
+// files remain the text-like ones are preferred.
+func openZipMember(file *os.File) (io.ReadCloser, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %v", err)
+	}
+
+	var candidates, textFiles []*zip.File
+	for _, member := range archive.File {
+		base := filepath.Base(member.Name)
+		if member.FileInfo().IsDir() || strings.HasPrefix(member.Name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		candidates = append(candidates, member)
+		switch inputExt(base) {
+			case ".txt", ".csv", ".tsv", ".vcf", ".bim", ".snp":
+				textFiles = append(textFiles, member)
+		}
+	}
+
+	if len(candidates) > 1 && len(textFiles) > 0 {
+		candidates = textFiles
+	}
+	switch len(candidates) {
+		case 0:
+			return nil, fmt.Errorf("zip archive contains no genotype file")
+		case 1:
+			return candidates[0].Open()
+		default:
+			var names []string
+			for _, member := range candidates {
+				names = append(names, member.Name)
+			}
+			return nil, fmt.Errorf("zip archive contains several files: %s", strings.Join(names, ", "))
+	}
+}
+
+// inputExt returns the lower-cased extension of a filename, ignoring a
+// trailing compression extension such as .gz.
+func inputExt(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, compressed := range compressionExts {
+		if ext == compressed {
+			return strings.ToLower(filepath.Ext(strings.TrimSuffix(filename, filepath.Ext(filename))))
+		}
+	}
+	return ext
+}
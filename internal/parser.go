@@ -1,287 +1,357 @@
 package internal
 
 import (
-	"os"
 	"fmt"
+	"iter"
+	"math"
 	"bufio"
+	"regexp"
 	"strings"
 	"strconv"
 	"path/filepath"
 )
 
-func ParseAncestryDNA(filename string) ParseResult {
-	file, err := os.Open(filename)
-	if err != nil {
-		return ParseResult{Err: fmt.Errorf("error opening file: %v", err)}
-	}
-	defer file.Close()
-
-	var records []DNARecord
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") || line == "" {
-			continue
+// scanRecords streams the records of a text file through parseLine, which
+// returns false for lines that hold no record and a problem for malformed
+// ones. The file is opened each time the sequence is iterated and closed when
+// the iteration stops.
+func scanRecords(filename string, opts ParseOptions, parseLine func(line string) (DNARecord, bool, *ParseError)) iter.Seq2[DNARecord, error] {
+	return func(yield func(DNARecord, error) bool) {
+		file, err := OpenInput(filename)
+		if err != nil {
+			yield(DNARecord{}, fmt.Errorf("error opening file: %v", err))
+			return
 		}
-		if line == "rsid\tchromosome\tposition\tallele1\tallele2" {
-			continue
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			record, ok, problem := parseLine(scanner.Text())
+			if problem != nil {
+				problem.File, problem.Line = filename, lineNumber
+				if !handleProblem(*problem, opts, yield) {
+					return
+				}
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if !yield(record, nil) {
+				return
+			}
 		}
 
-		fields := strings.Split(line, "\t")
-		if len(fields) >= 5 {
-			record := DNARecord{
-				RSID:        fields[0],
-				Chromosome:  fields[1],
-				Position:    fields[2],
-				Allele1:     fields[3],
-				Allele2:     fields[4],
-				RawGenotype: fields[3] + fields[4],
-			}
-			records = append(records, record)
+		if err := scanner.Err(); err != nil {
+			yield(DNARecord{}, fmt.Errorf("error reading file: %v", err))
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return ParseResult{Err: fmt.Errorf("error reading file: %v", err)}
+// genotypeLine builds a record from the rsid, chromosome, position and
+// genotype columns shared by most vendor files.
+func genotypeLine(fields []string) (DNARecord, bool, *ParseError) {
+	if problem := fieldCountProblem(fields, 4); problem != nil {
+		return DNARecord{}, false, problem
 	}
-
-	return ParseResult{
-		Data: DNAData{
-			Records: records,
-			Format:  "ancestry",
-		},
+	if _, err := strconv.Atoi(fields[2]); err != nil {
+		return DNARecord{}, false, &ParseError{Column: 3, Reason: fmt.Sprintf("invalid position %q", fields[2])}
 	}
+	if genotype := fields[3]; genotype == "" || len(genotype) > 2 {
+		return DNARecord{}, false, &ParseError{Column: 4, Reason: fmt.Sprintf("invalid genotype %q", genotype)}
+	}
+	return genotypeRecord(fields[0], fields[1], fields[2], fields[3]), true, nil
 }
 
-func Parse23andMe(filename string) ParseResult {
-	file, err := os.Open(filename)
-	if err != nil {
-		return ParseResult{Err: fmt.Errorf("error opening file: %v", err)}
+// genotypeRecord builds a record from a single genotype column such as "AG".
+// A single letter is a haploid call, and an empty column a no-call.
+func genotypeRecord(rsid, chromosome, position, genotype string) DNARecord {
+	if genotype == "" {
+		genotype = "--"
 	}
-	defer file.Close()
-
-	var records []DNARecord
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") || line == "" {
-			continue
-		}
-		if line == "rsid\tchromosome\tposition\tgenotype" {
-			continue
-		}
-
-		fields := strings.Split(line, "\t")
-		if len(fields) >= 4 {
-			genotype := fields[3]
-			allele1 := string(genotype[0])
-			allele2 := allele1
-			if len(genotype) > 1 {
-				allele2 = string(genotype[1])
-			}
-
-			record := DNARecord{
-				RSID:        fields[0],
-				Chromosome:  fields[1],
-				Position:    fields[2],
-				Allele1:     allele1,
-				Allele2:     allele2,
-				RawGenotype: genotype,
-			}
-			records = append(records, record)
-		}
+	allele1 := string(genotype[0])
+	allele2 := allele1
+	ploidy := 1
+	if len(genotype) > 1 {
+		allele2 = string(genotype[1])
+		ploidy = 2
 	}
 
-	if err := scanner.Err(); err != nil {
-		return ParseResult{Err: fmt.Errorf("error reading file: %v", err)}
+	return DNARecord{
+		RSID:        rsid,
+		Chromosome:  ParseChromosome(chromosome),
+		Position:    position,
+		Allele1:     allele1,
+		Allele2:     allele2,
+		RawGenotype: genotype,
+		Ploidy:      ploidy,
 	}
+}
 
-	return ParseResult{
-		Data: DNAData{
-			Records: records,
-			Format:  "23andme",
-		},
-	}
+// Template readers, by file extension. Each builds a record from the fields
+// of a data line; header holds the column positions of the header line, or
+// is nil when the file has none. Like the kit line parsers they return false
+// for lines that hold no site and a problem for malformed ones.
+var templateParsers = map[string]func(fields []string, header map[string]int) (TemplateRecord, bool, *ParseError){
+	".bim":    bimTemplate,
+	".snp":    snpTemplate,
+	".map":    mapTemplate,
+	".pvar":   pvarTemplate,
+	".vcf":    columnTemplate,
+	".legend": legendTemplate,
 }
 
-func ParseFTDNA(filename string) ParseResult {
-	file, err := os.Open(filename)
-	if err != nil {
-		return ParseResult{Err: fmt.Errorf("error opening file: %v", err)}
+// ParseTemplate streams the sites of a .bim, .snp, .map, .pvar, .legend or
+// sites-only .vcf file. Like the kit parsers, the file is read again each
+// time the sequence is iterated. Templates without a genetic position record
+// it as NaN, and templates without alleles leave them empty. Malformed lines
+// are handled as opts.Strict says, as in the kit parsers.
+func ParseTemplate(filename string, opts ParseOptions) (iter.Seq2[TemplateRecord, error], error) {
+	// Check file extension
+	ext := inputExt(filename)
+	parseLine, ok := templateParsers[ext]
+	if !ok {
+		return nil, fmt.Errorf("unsupported file extension: %s. Supported files: .bim, .snp, .map, .pvar, .legend, .vcf", ext)
+	}
+	// IMPUTE legend files hold one chromosome, named in the file name
+	chromosome := ""
+	if ext == ".legend" {
+		chromosome = chromosomeFromName(filename)
 	}
-	defer file.Close()
-
-	var records []DNARecord
-	scanner := bufio.NewScanner(file)
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") || line == "" {
-			continue
-		}
-		if line == "RSID,CHROMOSOME,POSITION,RESULT" {
-			continue
+	return func(yield func(TemplateRecord, error) bool) {
+		file, err := OpenInput(filename)
+		if err != nil {
+			yield(TemplateRecord{}, fmt.Errorf("error opening alignFile: %v", err))
+			return
 		}
+		defer file.Close()
 
-		fields := strings.Split(line, ",")
-		if len(fields) >= 4 {
-			genotype := fields[3]
-			allele1 := string(genotype[0])
-			allele2 := allele1
-			if len(genotype) > 1 {
-				allele2 = string(genotype[1])
+		scanner := bufio.NewScanner(file)
+
+		var header map[string]int
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			line := scanner.Text()
+			if strings.HasPrefix(line, "##") || line == "" {
+				continue
+			}
+			fields := strings.Fields(line)
+			if strings.HasPrefix(line, "#") || (ext == ".legend" && header == nil) {
+				header = headerColumns(fields)
+				continue
 			}
 
-			record := DNARecord{
-				RSID:        fields[0],
-				Chromosome:  fields[1],
-				Position:    fields[2],
-				Allele1:     allele1,
-				Allele2:     allele2,
-				RawGenotype: genotype,
+			record, ok, problem := parseLine(fields, header)
+			if problem != nil {
+				problem.File, problem.Line = filename, lineNumber
+				if !handleProblem(*problem, opts, yield) {
+					return
+				}
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if record.Chromosome == "" {
+				record.Chromosome = ParseChromosome(chromosome)
+			}
+			if record.Chromosome == "" {
+				yield(TemplateRecord{}, fmt.Errorf("no chromosome for %s in %s, name the file after its chromosome (e.g., chr22.legend)", record.RSID, filename))
+				return
+			}
+
+			if !yield(record, nil) {
+				return
 			}
-			records = append(records, record)
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		return ParseResult{Err: fmt.Errorf("error reading file: %v", err)}
+		if err := scanner.Err(); err != nil {
+			yield(TemplateRecord{}, fmt.Errorf("error reading alignFile: %v", err))
+		}
+	}, nil
+}
+
+// headerColumns maps the lower-cased column names of a header line, without
+// the leading #, to their positions.
+func headerColumns(fields []string) map[string]int {
+	columns := make(map[string]int, len(fields))
+	for i, field := range fields {
+		columns[strings.ToLower(strings.TrimPrefix(field, "#"))] = i
 	}
+	return columns
+}
 
-	return ParseResult{
-		Data: DNAData{
-			Records: records,
-			Format:  "ftdna",
-		},
+// bimTemplate reads a PLINK .bim line: chromosome, ID, cM, position, A1, A2.
+func bimTemplate(fields []string, _ map[string]int) (TemplateRecord, bool, *ParseError) {
+	if problem := fieldCountProblem(fields, 6); problem != nil {
+		return TemplateRecord{}, false, problem
+	}
+	value, problem := geneticPosition(fields[2], 3)
+	if problem != nil {
+		return TemplateRecord{}, false, problem
 	}
+	return TemplateRecord{
+		Chromosome:  ParseChromosome(fields[0]),
+		RSID:        fields[1],
+		Value:       value,
+		Position:    fields[3],
+		ReferenceA1: fields[4],
+		ReferenceA2: fields[5],
+	}, true, nil
 }
 
-func ParseMyHeritage(filename string) ParseResult {
-	file, err := os.Open(filename)
+// geneticPosition parses the cM column, the column-th of the line.
+func geneticPosition(s string, column int) (float64, *ParseError) {
+	value, err := parseScientificNotation(s)
 	if err != nil {
-		return ParseResult{Err: fmt.Errorf("error opening file: %v", err)}
+		return 0, &ParseError{Column: column, Reason: fmt.Sprintf("invalid genetic position %q", s)}
 	}
-	defer file.Close()
-
-	var records []DNARecord
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") || line == "" {
-			continue
-		}
-		if line == "RSID,CHROMOSOME,POSITION,RESULT" {
-			continue
-		}
-
-		fields := strings.Split(line, ",")
-		for i, field := range fields {
-			fields[i] = strings.Trim(field, "\"")
-		}
-
-		if len(fields) >= 4 {
-			genotype := fields[3]
-			allele1 := string(genotype[0])
-			allele2 := allele1
-			if len(genotype) > 1 {
-				allele2 = string(genotype[1])
-			}
+	return value, nil
+}
 
-			record := DNARecord{
-				RSID:        fields[0],
-				Chromosome:  fields[1],
-				Position:    fields[2],
-				Allele1:     allele1,
-				Allele2:     allele2,
-				RawGenotype: genotype,
-			}
-			records = append(records, record)
-		}
+// snpTemplate reads an EIGENSTRAT .snp line, which swaps the first two
+// columns of a .bim line. Its fifth column is the reference allele.
+func snpTemplate(fields []string, header map[string]int) (TemplateRecord, bool, *ParseError) {
+	record, ok, problem := bimTemplate(fields, header)
+	if problem != nil {
+		return record, ok, problem
 	}
+	record.Chromosome, record.RSID = ParseChromosome(fields[1]), fields[0]
+	record.KnownReference = true
+	return record, ok, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return ParseResult{Err: fmt.Errorf("error reading file: %v", err)}
+// mapTemplate reads a PLINK .map line, a .bim line without alleles.
+func mapTemplate(fields []string, _ map[string]int) (TemplateRecord, bool, *ParseError) {
+	if problem := fieldCountProblem(fields, 4); problem != nil {
+		return TemplateRecord{}, false, problem
 	}
-
-	return ParseResult{
-		Data: DNAData{
-			Records: records,
-			Format:  "myheritage",
-		},
+	value, problem := geneticPosition(fields[2], 3)
+	if problem != nil {
+		return TemplateRecord{}, false, problem
 	}
+	return TemplateRecord{
+		Chromosome: ParseChromosome(fields[0]),
+		RSID:       fields[1],
+		Value:      value,
+		Position:   fields[3],
+	}, true, nil
 }
 
-func ParseTemplate(filename string) ([]TemplateRecord, error) {
-	// Check file extension
-	ext := strings.ToLower(filepath.Ext(filename))
-	if ext != ".bim" && ext != ".snp" {
-		return nil, fmt.Errorf("unsupported file extension: %s. Only .bim and .snp files are supported", ext)
+// pvarTemplate reads a plink2 .pvar line. A .pvar without a header line is
+// laid out like a .bim.
+func pvarTemplate(fields []string, header map[string]int) (TemplateRecord, bool, *ParseError) {
+	if header == nil {
+		return bimTemplate(fields, nil)
 	}
+	return columnTemplate(fields, header)
+}
 
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("error opening alignFile: %v", err)
+// columnTemplate reads a line of a file with a #CHROM header, a .pvar or a
+// sites-only VCF. Only biallelic sites are kept, and the genetic position
+// comes from the optional CM column of a .pvar.
+func columnTemplate(fields []string, header map[string]int) (TemplateRecord, bool, *ParseError) {
+	columns, problem := requiredColumns(fields, header, "chrom", "pos", "id", "ref", "alt")
+	if problem != nil {
+		return TemplateRecord{}, false, problem
+	}
+	chrom, pos, id, ref, alt := columns[0], columns[1], columns[2], columns[3], columns[4]
+	if strings.Contains(alt, ",") {
+		return TemplateRecord{}, false, nil
 	}
-	defer file.Close()
-
-	var records []TemplateRecord
-	scanner := bufio.NewScanner(file)
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") || line == "" {
-			continue
+	value := math.NaN()
+	if cM, ok := column(fields, header, "cm"); ok {
+		if value, problem = geneticPosition(cM, header["cm"]+1); problem != nil {
+			return TemplateRecord{}, false, problem
 		}
+	}
+	return TemplateRecord{
+		Chromosome:  ParseChromosome(chrom),
+		RSID:        id,
+		Value:       value,
+		Position:    pos,
+		ReferenceA1:    ref,
+		ReferenceA2:    alt,
+		KnownReference: true,
+	}, true, nil
+}
 
-		fields := strings.Fields(line)
+// legendTemplate reads an IMPUTE .legend line: ID, position, a0 and a1.
+// Legend files have no chromosome column unless the ID carries one as in
+// "1:10583:G:A"; ParseTemplate otherwise fills it from the file name. IDs
+// such as "rs58108140:10583:G:A" are cut down to the rsID.
+func legendTemplate(fields []string, header map[string]int) (TemplateRecord, bool, *ParseError) {
+	columns, problem := requiredColumns(fields, header, "id", "position", "a0", "a1")
+	if problem != nil {
+		return TemplateRecord{}, false, problem
+	}
+	id, pos, a0, a1 := columns[0], columns[1], columns[2], columns[3]
+
+	record := TemplateRecord{
+		RSID:        id,
+		Value:       math.NaN(),
+		Position:    pos,
+		ReferenceA1:    a0,
+		ReferenceA2:    a1,
+		KnownReference: true,
+	}
+	if chrom, ok := column(fields, header, "chr"); ok {
+		record.Chromosome = ParseChromosome(chrom)
+	}
+	if parts := strings.Split(id, ":"); len(parts) > 1 {
+		switch {
+			case strings.HasPrefix(parts[0], "rs"):
+				record.RSID = parts[0]
+			case parts[1] == pos && record.Chromosome == "":
+				record.Chromosome = ParseChromosome(parts[0])
+		}
+	}
+	return record, true, nil
+}
 
-		if ext == ".bim" {
-			if len(fields) < 6 {
-				continue // Skip invalid lines
-			}
-			value, err := parseScientificNotation(fields[2])
-			if err != nil {
-				continue // Skip lines with invalid scientific notation
-			}
-			record := TemplateRecord{
-				Chromosome:  fields[0],
-				RSID:       fields[1],
-				Value:      value,
-				Position:   fields[3],
-				ReferenceA1: fields[4],
-				ReferenceA2: fields[5],
-			}
-			records = append(records, record)
-		} else { // .snp file
-			if len(fields) < 6 {
-				continue // Skip invalid lines
-			}
-			value, err := parseScientificNotation(fields[2])
-			if err != nil {
-				continue // Skip lines with invalid scientific notation
-			}
-			record := TemplateRecord{
-				Chromosome:  fields[1],
-				RSID:       fields[0],
-				Value:      value,
-				Position:   fields[3],
-				ReferenceA1: fields[4],
-				ReferenceA2: fields[5],
-			}
-			records = append(records, record)
+// requiredColumns returns the named columns of a line, or a problem when the
+// header lacks one or the line is too short to hold it.
+func requiredColumns(fields []string, header map[string]int, names ...string) ([]string, *ParseError) {
+	values := make([]string, len(names))
+	for i, name := range names {
+		index, ok := header[name]
+		if !ok {
+			return nil, &ParseError{Reason: fmt.Sprintf("no %s column in the header", strings.ToUpper(name))}
+		}
+		if problem := fieldCountProblem(fields, index+1); problem != nil {
+			return nil, problem
 		}
+		values[i] = fields[index]
 	}
+	return values, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading alignFile: %v", err)
+// column returns the named column of a line.
+func column(fields []string, header map[string]int, name string) (string, bool) {
+	i, ok := header[name]
+	if !ok || i >= len(fields) {
+		return "", false
 	}
+	return fields[i], true
+}
 
-	return records, nil
+// chromosomeFromName finds the chromosome in a file name such as
+// "1000GP_Phase3_chr22.legend.gz", or returns "" when there is none.
+func chromosomeFromName(filename string) string {
+	match := chromosomeName.FindStringSubmatch(filepath.Base(filename))
+	if match == nil {
+		return ""
+	}
+	return match[1]
 }
 
+var chromosomeName = regexp.MustCompile(`(?i)chr(?:om(?:osome)?)?[_-]?([0-9]{1,2}|X|Y|MT|M)(?:[^0-9A-Za-z]|$)`)
+
 func parseScientificNotation(s string) (float64, error) {
 	return strconv.ParseFloat(s, 64)
 }
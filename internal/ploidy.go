@@ -0,0 +1,52 @@
+package internal
+
+// ploidyOf returns the number of copies of a chromosome in a sample of the
+// given sex, or 0 when there is no rule and the call keeps the ploidy its
+// source gave it. MT is haploid and so is Y; X is haploid in males and
+// diploid in females.
+func ploidyOf(chromosome Chromosome, sex Sex) int {
+	switch chromosome {
+		case ChrMT, ChrY:
+			return 1
+		case ChrX:
+			switch sex {
+				case SexMale:
+					return 1
+				case SexFemale:
+					return 2
+			}
+	}
+	return 0
+}
+
+// ApplyPloidy sets the ploidy of the sex chromosomes and MT from the sex of
+// the sample. A heterozygous call on a haploid chromosome is a genotyping
+// error and becomes a no-call, as does any call on Y in a female.
+func ApplyPloidy(data DNAData, sex Sex) DNAData {
+	records := data.Records
+	data.Records = func(yield func(DNARecord, error) bool) {
+		for record, err := range records {
+			if err == nil {
+				record = applyPloidy(record, sex)
+			}
+			if !yield(record, err) {
+				return
+			}
+		}
+	}
+	return data
+}
+
+func applyPloidy(record DNARecord, sex Sex) DNARecord {
+	ploidy := ploidyOf(record.Chromosome, sex)
+	if ploidy == 0 {
+		return record
+	}
+	record.Ploidy = ploidy
+
+	if ploidy == 1 && (record.Allele1 != record.Allele2 || (record.Chromosome == ChrY && sex == SexFemale)) {
+		record.Allele1, record.Allele2 = "-", "-"
+	}
+	record.RawGenotype = record.Allele1 + record.Allele2
+	return record
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// Number of problems kept by a ParseReport, the rest are only counted
+const maxReportedProblems = 20
+
+// ParseError is a malformed line of an input file. Column is 1-based, and 0
+// when the problem is not tied to one column.
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Reason)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Reason)
+}
+
+// ParseReport collects the malformed lines skipped by a lenient parse, of the
+// kit and of the files around it such as the template. Kits and templates
+// are read more than once, so each line is only counted the first time.
+type ParseReport struct {
+	Problems []ParseError
+	Count    int
+	seen     map[ParseError]bool
+}
+
+func (r *ParseReport) add(problem ParseError) {
+	if r == nil || r.seen[problem] {
+		return
+	}
+	if r.seen == nil {
+		r.seen = make(map[ParseError]bool)
+	}
+	r.seen[problem] = true
+	if len(r.Problems) < maxReportedProblems {
+		r.Problems = append(r.Problems, problem)
+	}
+	r.Count++
+}
+
+// reportProblem deals with a malformed line: in strict mode it returns it as
+// the error, otherwise the line is reported and nil returned.
+func reportProblem(problem ParseError, opts ParseOptions) error {
+	if opts.Strict {
+		return &problem
+	}
+	opts.Report.add(problem)
+	return nil
+}
+
+// handleProblem is reportProblem for iterators: in strict mode it ends the
+// iteration with the error. It returns false when the iteration must stop.
+func handleProblem[T any](problem ParseError, opts ParseOptions, yield func(T, error) bool) bool {
+	if err := reportProblem(problem, opts); err != nil {
+		var zero T
+		yield(zero, err)
+		return false
+	}
+	return true
+}
+
+// fieldCountProblem reports a line with fewer than n fields, pointing at the
+// first missing one.
+func fieldCountProblem(fields []string, n int) *ParseError {
+	if len(fields) >= n {
+		return nil
+	}
+	return &ParseError{Column: len(fields) + 1, Reason: fmt.Sprintf("expected %d fields, found %d", n, len(fields))}
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"fmt"
+	"bufio"
+	"strings"
+)
+
+// LoadRSIDMap reads a table of internal IDs, such as the i-numbers of
+// 23andMe, and the rsIDs they stand for. Each line holds the two IDs
+// separated by tabs, spaces or a comma; lines whose second column is not an
+// rsID, such as a header, are skipped.
+func LoadRSIDMap(filename string) (map[string]string, error) {
+	file, err := OpenInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	rsids := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ReplaceAll(scanner.Text(), ",", " ")
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || !strings.HasPrefix(fields[1], "rs") {
+			continue
+		}
+		rsids[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return rsids, nil
+}
+
+// RenameRecords gives the records listed in the map their rsID, so that they
+// match templates by ID.
+func RenameRecords(data DNAData, rsids map[string]string) DNAData {
+	records := data.Records
+	data.Records = func(yield func(DNARecord, error) bool) {
+		for record, err := range records {
+			if rsid, ok := rsids[record.RSID]; ok {
+				record.RSID = rsid
+			}
+			if !yield(record, err) {
+				return
+			}
+		}
+	}
+	return data
+}
@@ -1,184 +1,367 @@
 package internal
 
 import (
-	"os"
 	"fmt"
+	"iter"
+	"sort"
+	"strconv"
 )
 
-func WriteDNAData(data DNAData, outFile string, outFormat string) error {
-	output, err := os.Create(outFile)
+func WriteDNAData(data DNAData, outFile string, outFormat string, opts WriteOptions) error {
+	writer, err := NewWriter(outFile, outFormat, opts)
 	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
+		return err
 	}
-	defer output.Close()
 
-	switch outFormat {
-		case "23andme":
-			output.WriteString("# rsid\tchromosome\tposition\tgenotype\n")
-		case "ancestry":
-			output.WriteString("# rsid\tchromosome\tposition\tallele1\tallele2\n")
-		case "ftdnav2", "ftdnav1", "myheritage":
-			output.WriteString("RSID,CHROMOSOME,POSITION,RESULT\n")
-		default:
-			return fmt.Errorf("unsupported output format: %s", outFormat)
-	}
-
-	for _, record := range data.Records {
-		var outputLine string
-		switch outFormat {
-			case "23andme":
-				outputLine = fmt.Sprintf("%s\t%s\t%s\t%s\n",
-							 record.RSID, record.Chromosome, record.Position, record.RawGenotype)
-			case "ancestry":
-				outputLine = fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n",
-							 record.RSID, record.Chromosome, record.Position, record.Allele1, record.Allele2)
-			case "ftdnav2":
-				outputLine = fmt.Sprintf("%s,%s,%s,%s\n",
-							 record.RSID, record.Chromosome, record.Position, record.RawGenotype)
-			case "ftdnav1", "myheritage":
-				outputLine = fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\"\n",
-							 record.RSID, record.Chromosome, record.Position, record.RawGenotype)
+	for record, err := range data.Records {
+		if err != nil {
+			abortWriter(writer)
+			return err
+		}
+		if err := writer.Write(record); err != nil {
+			abortWriter(writer)
+			return err
 		}
-		output.WriteString(outputLine)
 	}
 
-	return nil
+	return writer.Close()
 }
 
-func getDefaultGenotype(template TemplateRecord, outFormat string) (string, string, string) {
-	// Default to the reference alleles
-	allele1 := template.ReferenceA1
-	allele2 := template.ReferenceA2
-	rawGenotype := allele1 + allele2
-
-	// For some formats, we might want to use different defaults
-	switch outFormat {
-		case "23andme", "ftdnav2", "ftdnav1", "myheritage":
-			// These formats typically use "--" for missing data
-			return "--", "--", "--"
-		case "ancestry":
-			// Ancestry format uses 0 for missing data
-			return "0", "0", rawGenotype
-		default:
-			return allele1, allele2, rawGenotype
+func AlignDNA(data DNAData, templateRecords iter.Seq2[TemplateRecord, error], outFile string, outFormat string, flip bool, opts WriteOptions) error {
+	kitSmaller, err := kitIsSmaller(data.Records, templateRecords)
+	if err != nil {
+		return err
+	}
+
+	// When the template is the smaller side, hold its sites and only keep the
+	// kit records that match them
+	var wanted *templateSites
+	if !kitSmaller {
+		if wanted, err = collectTemplateSites(templateRecords); err != nil {
+			return err
+		}
 	}
-}
 
-func AlignDNA(data DNAData, templateRecords []TemplateRecord, outFile string, outFormat string, flip bool) error {
-	// Create a map for quick lookup of DNA records by RSID
-	dnaMap := make(map[string]DNARecord)
-	for _, record := range data.Records {
-		dnaMap[record.RSID] = record
+	kit := newKitIndex()
+	for record, err := range data.Records {
+		if err != nil {
+			return err
+		}
+		if wanted == nil || wanted.matches(record) {
+			kit.add(record)
+		}
 	}
+	kit.finish()
+	wanted = nil // Release the template sites before writing
 
-	// Create output file
-	output, err := os.Create(outFile)
+	// Create output writer, which also writes the header
+	writer, err := NewWriter(outFile, outFormat, opts)
 	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
-	}
-	defer output.Close()
-
-	// Write header based on format
-	switch outFormat {
-		case "23andme":
-			output.WriteString("# rsid\tchromosome\tposition\tgenotype\n")
-		case "ancestry":
-			output.WriteString("# rsid\tchromosome\tposition\tallele1\tallele2\n")
-		case "ftdnav2", "ftdnav1", "myheritage":
-			output.WriteString("RSID,CHROMOSOME,POSITION,RESULT\n")
-		default:
-			return fmt.Errorf("unsupported output format: %s", outFormat)
+		return err
 	}
+	templateWriter, usesTemplate := writer.(TemplateWriter)
 
 	// Track statistics
-	var totalSnps, matchedSnps int
+	var totalSnps, matchedSnps, blockSnps, unfilledSnps int
 
 	// Process each template record
-	for _, template := range templateRecords {
+	for template, err := range templateRecords {
+		if err != nil {
+			abortWriter(writer)
+			return err
+		}
 		totalSnps++
-		var outputLine string
+		record := DNARecord{
+			RSID:       template.RSID,
+			Chromosome: template.Chromosome,
+			Position:   template.Position,
+			Status:     StatusMissing,
+			Ploidy:     ploidyOf(template.Chromosome, opts.Sex),
+		}
 
-		if dnaRecord, exists := dnaMap[template.RSID]; exists {
+		dnaRecord, exists := kit.lookup(template)
+		if exists && usesTemplate && isIndelCall(dnaRecord) && !template.codesIndels() {
+			// A D/I call cannot be written against the alleles of a SNP site
+			exists = false
+		}
+		dnaRecord.Status = StatusMatched
+		if !exists && !template.KnownReference && kit.inReferenceBlock(template) {
+			unfilledSnps++
+		} else if !exists && template.hasAlleles() && kit.inReferenceBlock(template) {
+			// Sites inside a gVCF reference block are homozygous for the
+			// reference; templates that do not tell it are not filled
+			exists = true
+			blockSnps++
+			ref := template.ReferenceA1
+			dnaRecord = DNARecord{
+				Allele1:     ref,
+				Allele2:     ref,
+				RawGenotype: ref + ref,
+				Status:      StatusFilled,
+			}
+		}
+		if exists {
 			matchedSnps++
+			record.Status = dnaRecord.Status
+			if dnaRecord.Ploidy != 0 {
+				record.Ploidy = dnaRecord.Ploidy
+			}
 			// Use the actual DNA record data
-
 			if flip {
-				flipAllele1, flipAllele2, flipGenotype := flipping(dnaRecord, template, outFormat)
-				switch outFormat {
-					case "23andme":
-						outputLine = fmt.Sprintf("%s\t%s\t%s\t%s\n",
-									 template.RSID, template.Chromosome, template.Position, flipGenotype)
-					case "ancestry":
-						outputLine = fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n",
-									 template.RSID, template.Chromosome, template.Position, flipAllele1, flipAllele2)
-					case "ftdnav2":
-						outputLine = fmt.Sprintf("%s,%s,%s,%s\n",
-									 template.RSID, template.Chromosome, template.Position, flipGenotype)
-					case "ftdnav1", "myheritage":
-						outputLine = fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\"\n",
-									 template.RSID, template.Chromosome, template.Position, flipGenotype)
+				record.Allele1, record.Allele2, record.RawGenotype = flipping(dnaRecord, template)
+				if isFlipped(dnaRecord, record) {
+					record.Status = StatusFlipped
 				}
 			} else {
-				switch outFormat {
-					case "23andme":
-						outputLine = fmt.Sprintf("%s\t%s\t%s\t%s\n",
-									 template.RSID, template.Chromosome, template.Position, dnaRecord.RawGenotype)
-					case "ancestry":
-						outputLine = fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n",
-									 template.RSID, template.Chromosome, template.Position, dnaRecord.Allele1, dnaRecord.Allele2)
-					case "ftdnav2":
-						outputLine = fmt.Sprintf("%s,%s,%s,%s\n",
-									 template.RSID, template.Chromosome, template.Position, dnaRecord.RawGenotype)
-					case "ftdnav1", "myheritage":
-						outputLine = fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\"\n",
-									 template.RSID, template.Chromosome, template.Position, dnaRecord.RawGenotype)
-				}
+				record.Allele1, record.Allele2, record.RawGenotype = dnaRecord.Allele1, dnaRecord.Allele2, dnaRecord.RawGenotype
+			}
+			if usesTemplate && isIndelCall(record) {
+				// Writers code the call against the template alleles
+				record.Allele1, record.Allele2 = template.indelSequence(record.Allele1), template.indelSequence(record.Allele2)
+				record.RawGenotype = record.Allele1 + record.Allele2
 			}
+		}
+		// Missing SNPs keep empty alleles, which the writer renders as a no-call
+
+		if usesTemplate {
+			err = templateWriter.WriteTemplate(template, record)
 		} else {
-			// Use default values for missing SNPs
-			defaultAllele1, defaultAllele2, defaultGenotype := getDefaultGenotype(template, outFormat)
-
-				switch outFormat {
-					case "23andme":
-						outputLine = fmt.Sprintf("%s\t%s\t%s\t%s\n",
-									 template.RSID, template.Chromosome, template.Position, defaultGenotype)
-					case "ancestry":
-						outputLine = fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n",
-									 template.RSID, template.Chromosome, template.Position, defaultAllele1, defaultAllele2)
-					case "ftdnav2":
-						outputLine = fmt.Sprintf("%s,%s,%s,%s\n",
-									 template.RSID, template.Chromosome, template.Position, defaultGenotype)
-					case "ftdnav1", "myheritage":
-						outputLine = fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\"\n",
-									 template.RSID, template.Chromosome, template.Position, defaultGenotype)
-				}
+			err = writer.Write(record)
 		}
+		if err != nil {
+			abortWriter(writer)
+			return err
+		}
+	}
 
-		output.WriteString(outputLine)
+	if err := writer.Close(); err != nil {
+		return err
 	}
 
 	// Print statistics
 	fmt.Printf("[INFO] Total SNPs in template: %d\n", totalSnps)
 	fmt.Printf("[INFO] Matched SNPs: %d (%.1f%%)\n", matchedSnps, float64(matchedSnps)/float64(totalSnps)*100)
 	fmt.Printf("[INFO] Missing SNPs: %d (%.1f%%)\n", totalSnps-matchedSnps, float64(totalSnps-matchedSnps)/float64(totalSnps)*100)
+	if blockSnps > 0 {
+		fmt.Printf("[INFO] Matched from reference blocks: %d\n", blockSnps)
+	}
+	if unfilledSnps > 0 {
+		fmt.Printf("[WARNING] %d sites inside reference blocks were left missing, as the template does not tell the reference allele (use a .snp, .pvar, .legend or .vcf template).\n", unfilledSnps)
+	}
 
 	return nil
 }
 
-func flipping(dnaRecord DNARecord, template TemplateRecord, outFormat string) (string, string, string) {
-	if (dnaRecord.Allele1 != "C" && dnaRecord.Allele1 != "G" && dnaRecord.Allele1 != "T" && dnaRecord.Allele1 != "A") || (dnaRecord.Allele2 != "C" && dnaRecord.Allele2 != "G" && dnaRecord.Allele2 != "T" && dnaRecord.Allele2 != "A") {
-		switch outFormat {
-			case "23andme", "ftdnav2", "ftdnav1", "myheritage":
-				return "--", "--", "--"
-			case "ancestry":
-				return "0", "0", "0"
-			default:
-				return "--", "--", "--"
+// kitIndex looks kit records up by RSID, or by position for records without
+// one as in most WGS VCFs. gVCF reference blocks are kept as intervals.
+type kitIndex struct {
+	records map[string]DNARecord
+	blocks  map[Chromosome][]referenceBlock
+}
+
+type referenceBlock struct {
+	start, end int
+}
+
+func newKitIndex() *kitIndex {
+	return &kitIndex{
+		records: make(map[string]DNARecord),
+		blocks:  make(map[Chromosome][]referenceBlock),
+	}
+}
+
+func (k *kitIndex) add(record DNARecord) {
+	if block, ok := blockOf(record); ok {
+		k.blocks[record.Chromosome] = append(k.blocks[record.Chromosome], block)
+		return
+	}
+	k.records[recordKey(record)] = record
+}
+
+// finish sorts the reference blocks for lookups.
+func (k *kitIndex) finish() {
+	for _, blocks := range k.blocks {
+		sort.Slice(blocks, func(i, j int) bool {
+			return blocks[i].start < blocks[j].start
+		})
+	}
+}
+
+func (k *kitIndex) lookup(template TemplateRecord) (DNARecord, bool) {
+	if record, exists := k.records[template.RSID]; exists {
+		return record, true
+	}
+	record, exists := k.records[siteKey(template.Chromosome, template.Position)]
+	return record, exists
+}
+
+func (k *kitIndex) inReferenceBlock(template TemplateRecord) bool {
+	blocks := k.blocks[template.Chromosome]
+	position, err := strconv.Atoi(template.Position)
+	if len(blocks) == 0 || err != nil {
+		return false
+	}
+	// Last block starting at or before the position
+	i := sort.Search(len(blocks), func(i int) bool {
+		return blocks[i].start > position
+	}) - 1
+	return i >= 0 && blocks[i].end >= position
+}
+
+// blockOf returns the interval of a gVCF reference block record.
+func blockOf(record DNARecord) (referenceBlock, bool) {
+	if record.End == "" {
+		return referenceBlock{}, false
+	}
+	start, err := strconv.Atoi(record.Position)
+	if err != nil {
+		return referenceBlock{}, false
+	}
+	end, err := strconv.Atoi(record.End)
+	if err != nil {
+		return referenceBlock{}, false
+	}
+	return referenceBlock{start: start, end: end}, true
+}
+
+// templateSites holds the keys and sorted positions of every template site.
+type templateSites struct {
+	keys      map[string]struct{}
+	positions map[Chromosome][]int
+}
+
+func collectTemplateSites(templateRecords iter.Seq2[TemplateRecord, error]) (*templateSites, error) {
+	sites := &templateSites{
+		keys:      make(map[string]struct{}),
+		positions: make(map[Chromosome][]int),
+	}
+	for template, err := range templateRecords {
+		if err != nil {
+			return nil, err
+		}
+		sites.keys[template.RSID] = struct{}{}
+		sites.keys[siteKey(template.Chromosome, template.Position)] = struct{}{}
+		if position, err := strconv.Atoi(template.Position); err == nil {
+			sites.positions[template.Chromosome] = append(sites.positions[template.Chromosome], position)
+		}
+	}
+	for _, positions := range sites.positions {
+		sort.Ints(positions)
+	}
+	return sites, nil
+}
+
+// matches reports whether a kit record is needed for the template, either as
+// a site or as a reference block covering one.
+func (s *templateSites) matches(record DNARecord) bool {
+	if block, ok := blockOf(record); ok {
+		positions := s.positions[record.Chromosome]
+		i := sort.SearchInts(positions, block.start)
+		return i < len(positions) && positions[i] <= block.end
+	}
+	_, exists := s.keys[recordKey(record)]
+	return exists
+}
+
+// recordKey is the RSID of a record, or its position when the kit has no
+// identifier for it.
+func recordKey(record DNARecord) string {
+	if record.RSID == "" || record.RSID == "." {
+		return siteKey(record.Chromosome, record.Position)
+	}
+	return record.RSID
+}
+
+func siteKey(chromosome Chromosome, position string) string {
+	return string(chromosome) + ":" + position
+}
+
+// kitIsSmaller walks the kit and the template in lockstep and reports
+// whether the kit runs out first, so only the smaller side is read in full.
+func kitIsSmaller(records iter.Seq2[DNARecord, error], templateRecords iter.Seq2[TemplateRecord, error]) (bool, error) {
+	nextRecord, stopRecords := iter.Pull2(records)
+	defer stopRecords()
+	nextTemplate, stopTemplates := iter.Pull2(templateRecords)
+	defer stopTemplates()
+
+	for {
+		_, err, ok := nextRecord()
+		if !ok {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		_, err, ok = nextTemplate()
+		if !ok {
+			return false, nil
 		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// isFlipped reports whether flipping changed the alleles of a call, and not
+// only their order.
+func isFlipped(before, after DNARecord) bool {
+	if after.NoCall() {
+		return false
+	}
+	return !((before.Allele1 == after.Allele1 && before.Allele2 == after.Allele2) ||
+		(before.Allele1 == after.Allele2 && before.Allele2 == after.Allele1))
+}
+
+func isIndelCall(record DNARecord) bool {
+	return isIndelAllele(record.Allele1) && isIndelAllele(record.Allele2)
+}
+
+// codesIndels reports whether the template alleles can hold a D/I call: they
+// are D/I themselves, or sequences of different lengths such as AT and A.
+// Templates without alleles take the call as it is.
+func (t TemplateRecord) codesIndels() bool {
+	switch {
+		case !t.hasAlleles() || isIndelAllele(t.ReferenceA1) || isIndelAllele(t.ReferenceA2):
+			return true
+		case isMissingAllele(t.ReferenceA1) || isMissingAllele(t.ReferenceA2):
+			return false
+		default:
+			return len(t.ReferenceA1) != len(t.ReferenceA2)
+	}
+}
+
+// indelSequence turns a D/I allele into the template allele it stands for,
+// the shorter one for D and the longer one for I. Templates that code
+// indels as D/I, or cannot code them, keep the allele as it is.
+func (t TemplateRecord) indelSequence(allele string) string {
+	if !isIndelAllele(allele) || !t.hasAlleles() || isIndelAllele(t.ReferenceA1) || isIndelAllele(t.ReferenceA2) || !t.codesIndels() {
+		return allele
+	}
+	shorter, longer := t.ReferenceA1, t.ReferenceA2
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+	if allele == AlleleDeletion {
+		return shorter
+	}
+	return longer
+}
+
+func flipping(dnaRecord DNARecord, template TemplateRecord) (string, string, string) {
+	if !template.hasAlleles() {
+		// Nothing to flip against
+		return dnaRecord.Allele1, dnaRecord.Allele2, dnaRecord.RawGenotype
+	}
+	if isIndelCall(dnaRecord) {
+		// Indel calls have no strand to flip
+		return dnaRecord.Allele1, dnaRecord.Allele2, dnaRecord.RawGenotype
+	} else if !isBase(dnaRecord.Allele1) || !isBase(dnaRecord.Allele2) {
+		// Not a valid call, the writer renders it as a no-call
+		return "", "", ""
 	} else if dnaRecord.Allele1 != dnaRecord.Allele2 {
 		rawGenotype := template.ReferenceA1 + template.ReferenceA2
 		return template.ReferenceA1, template.ReferenceA2, rawGenotype
-	} else if dnaRecord.Allele1 == dnaRecord.Allele2 {
+	} else {
 		if dnaRecord.Allele1 != template.ReferenceA1 && dnaRecord.Allele1 != template.ReferenceA2 {
 			switch dnaRecord.Allele1 {
 				case "C":
@@ -192,8 +375,5 @@ func flipping(dnaRecord DNARecord, template TemplateRecord, outFormat string) (s
 			}
 		}
 		return dnaRecord.Allele1, dnaRecord.Allele2, dnaRecord.RawGenotype
-	} else {
-		return dnaRecord.Allele1, dnaRecord.Allele2, dnaRecord.RawGenotype
 	}
-
 }